@@ -0,0 +1,403 @@
+pub mod routes;
+pub mod sign;
+pub mod test_utils;
+pub mod tls;
+
+use std::{net::SocketAddr, sync::Arc};
+
+use tokio::{
+  io::{AsyncRead, AsyncReadExt, AsyncWrite, AsyncWriteExt},
+  net::TcpListener,
+};
+use tokio_rustls::TlsAcceptor;
+use tracing::debug;
+
+/// Bound shared by every connection type the server can hand to a route: plain [`TcpStream`]s
+/// and TLS-terminated streams alike.
+///
+/// [`TcpStream`]: tokio::net::TcpStream
+pub trait Stream: AsyncRead + AsyncWrite + Unpin + Send {}
+impl<T: AsyncRead + AsyncWrite + Unpin + Send> Stream for T {}
+
+/// Maximum number of bytes accepted for a single request head before the connection is dropped.
+const MAX_HEAD_BYTES: usize = 64 * 1024;
+
+/// A small HTTP/1.1 server used to exercise the prover against both well-behaved and
+/// deliberately pathological upstreams.
+///
+/// Unlike a framework-based server, every route handler writes directly to the underlying
+/// stream, which gives tests byte-level control over framing, segmentation, and protocol
+/// violations that a compliant HTTP library would refuse to produce.
+pub struct MockServer {
+  listener: TcpListener,
+  options:  Arc<MockServerOptions>,
+  tls:      Option<TlsAcceptor>,
+}
+
+/// Server-wide options used by routes that need configuration beyond their query string.
+#[derive(Clone, Debug, Default)]
+pub struct MockServerOptions {
+  /// Key used by `/signed-url` to validate HMAC-signed URLs; the route is disabled when
+  /// empty.
+  pub hmac_key:            String,
+  /// Holds back the server's first TLS handshake flight by this long, so clients can test
+  /// handshake-phase timeouts separately from application-phase ones. Only meaningful on a
+  /// TLS server; `None` completes handshakes promptly.
+  pub tls_handshake_delay: Option<std::time::Duration>,
+  /// Caps every write to the socket at this many bytes, the userspace analog of a tiny TCP
+  /// write buffer: responses leave in many small segments, stressing client reassembly.
+  /// Applies beneath TLS, so even handshake records are fragmented. `None` writes normally.
+  pub write_segment_bytes: Option<usize>,
+}
+
+impl MockServer {
+  /// Binds the server to the given address with default options.
+  pub async fn bind(addr: &str) -> std::io::Result<Self> {
+    Self::bind_with_options(addr, MockServerOptions::default()).await
+  }
+
+  /// Binds the server to the given address without accepting connections yet.
+  pub async fn bind_with_options(addr: &str, options: MockServerOptions) -> std::io::Result<Self> {
+    Ok(Self {
+      listener: TcpListener::bind(addr).await?,
+      options:  Arc::new(options),
+      tls:      None,
+    })
+  }
+
+  /// Binds a TLS-terminating server using the given PEM certificate chain and private key.
+  /// Routes observe handshake parameters such as the SNI via [`Request::sni`].
+  pub async fn bind_tls(
+    addr: &str,
+    cert_path: &str,
+    key_path: &str,
+    options: MockServerOptions,
+  ) -> std::io::Result<Self> {
+    Ok(Self {
+      listener: TcpListener::bind(addr).await?,
+      options:  Arc::new(options),
+      tls:      Some(tls::acceptor(cert_path, key_path)?),
+    })
+  }
+
+  /// Returns the address the server is bound to, useful with ephemeral ports.
+  pub fn local_addr(&self) -> std::io::Result<SocketAddr> { self.listener.local_addr() }
+
+  /// Accepts connections forever, handling each on its own task.
+  pub async fn run(self) -> std::io::Result<()> {
+    loop {
+      let (stream, peer) = self.listener.accept().await?;
+      debug!("accepted connection from {}", peer);
+      let options = self.options.clone();
+      let tls = self.tls.clone();
+      tokio::spawn(async move {
+        let stream = SegmentedWrites::new(stream, options.write_segment_bytes);
+        let result = match tls {
+          Some(acceptor) => {
+            let stream = tls::DelayedHandshake::new(stream, options.tls_handshake_delay);
+            match acceptor.accept(stream).await {
+              Ok(stream) => {
+                let sni = stream.get_ref().1.server_name().map(str::to_string);
+                handle_connection(stream, sni, options).await
+              },
+              Err(e) => {
+                debug!("TLS handshake with {} failed: {}", peer, e);
+                Ok(())
+              },
+            }
+          },
+          None => handle_connection(stream, None, options).await,
+        };
+        if let Err(e) = result {
+          debug!("connection from {} ended with error: {}", peer, e);
+        }
+      });
+    }
+  }
+}
+
+/// Stream wrapper that never writes more than `max` bytes at a time; see
+/// [`MockServerOptions::write_segment_bytes`]. With no cap configured it is a passthrough.
+struct SegmentedWrites<S> {
+  inner: S,
+  max:   Option<usize>,
+}
+
+impl<S> SegmentedWrites<S> {
+  fn new(inner: S, max: Option<usize>) -> Self { Self { inner, max } }
+}
+
+impl<S: AsyncRead + Unpin> tokio::io::AsyncRead for SegmentedWrites<S> {
+  fn poll_read(
+    self: std::pin::Pin<&mut Self>,
+    cx: &mut std::task::Context<'_>,
+    buf: &mut tokio::io::ReadBuf<'_>,
+  ) -> std::task::Poll<std::io::Result<()>> {
+    std::pin::Pin::new(&mut self.get_mut().inner).poll_read(cx, buf)
+  }
+}
+
+impl<S: AsyncWrite + Unpin> tokio::io::AsyncWrite for SegmentedWrites<S> {
+  fn poll_write(
+    self: std::pin::Pin<&mut Self>,
+    cx: &mut std::task::Context<'_>,
+    buf: &[u8],
+  ) -> std::task::Poll<std::io::Result<usize>> {
+    let this = self.get_mut();
+    let len = this.max.map_or(buf.len(), |max| buf.len().min(max.max(1)));
+    std::pin::Pin::new(&mut this.inner).poll_write(cx, &buf[..len])
+  }
+
+  fn poll_flush(
+    self: std::pin::Pin<&mut Self>,
+    cx: &mut std::task::Context<'_>,
+  ) -> std::task::Poll<std::io::Result<()>> {
+    std::pin::Pin::new(&mut self.get_mut().inner).poll_flush(cx)
+  }
+
+  fn poll_shutdown(
+    self: std::pin::Pin<&mut Self>,
+    cx: &mut std::task::Context<'_>,
+  ) -> std::task::Poll<std::io::Result<()>> {
+    std::pin::Pin::new(&mut self.get_mut().inner).poll_shutdown(cx)
+  }
+}
+
+/// What to do with the connection once a route handler has written its response.
+///
+/// Handlers that emit a well-framed response keep the connection alive so connection-reuse
+/// behavior can be tested; handlers that take over the raw stream close it afterwards since
+/// the peer can no longer rely on the framing.
+pub enum Flow {
+  KeepAlive,
+  Close,
+}
+
+/// A parsed HTTP/1.1 request, preserving the original header order and casing as well as the
+/// exact bytes read off the wire.
+pub struct Request {
+  pub method:  String,
+  pub target:  String,
+  pub version: String,
+  pub headers: Vec<(String, String)>,
+  pub body:    Vec<u8>,
+  pub raw:     Vec<u8>,
+  /// Bytes already read off the socket that belong to this request's not-yet-parsed body.
+  /// Only populated for chunked request bodies, which the parser leaves to the route: a
+  /// route consuming such a body must process these bytes before reading the stream again.
+  pub pending: Vec<u8>,
+  /// The TLS server name (SNI) the connection presented, `None` over plain TCP.
+  pub sni:     Option<String>,
+}
+
+impl Request {
+  /// Returns the request path without the query string.
+  pub fn path(&self) -> &str { self.target.split('?').next().unwrap_or(&self.target) }
+
+  /// Looks up a header value by case-insensitive name.
+  pub fn header(&self, name: &str) -> Option<&str> {
+    self.headers.iter().find(|(k, _)| k.eq_ignore_ascii_case(name)).map(|(_, v)| v.as_str())
+  }
+
+  /// Whether the request declares a chunked body, which the parser does not consume.
+  pub fn chunked(&self) -> bool {
+    self.header("Transfer-Encoding").is_some_and(|v| v.to_ascii_lowercase().contains("chunked"))
+  }
+
+  /// Returns the value of a query parameter, if present.
+  pub fn query(&self, key: &str) -> Option<&str> {
+    let query = self.target.split_once('?')?.1;
+    query.split('&').find_map(|pair| {
+      let (k, v) = pair.split_once('=').unwrap_or((pair, ""));
+      if k == key {
+        Some(v)
+      } else {
+        None
+      }
+    })
+  }
+}
+
+async fn handle_connection<S: Stream>(
+  mut stream: S,
+  sni: Option<String>,
+  options: Arc<MockServerOptions>,
+) -> std::io::Result<()> {
+  let mut buf = Vec::new();
+  loop {
+    let mut request = match read_request(&mut stream, &mut buf).await? {
+      Some(request) => request,
+      // The client closed the connection between requests.
+      None => return Ok(()),
+    };
+    request.sni = sni.clone();
+    debug!("{} {}", request.method, request.target);
+    match routes::handle(&request, &mut stream, &options).await? {
+      Flow::KeepAlive => continue,
+      Flow::Close => return Ok(()),
+    }
+  }
+}
+
+/// Reads and parses one request from the stream, buffering any pipelined bytes that belong to
+/// the next request. Returns `None` if the client closed the connection cleanly before sending
+/// another request.
+pub(crate) async fn read_request<S: Stream>(
+  stream: &mut S,
+  buf: &mut Vec<u8>,
+) -> std::io::Result<Option<Request>> {
+  let head_end = loop {
+    if let Some(pos) = find_subsequence(buf, b"\r\n\r\n") {
+      break pos + 4;
+    }
+    if buf.len() > MAX_HEAD_BYTES {
+      return Err(std::io::Error::new(std::io::ErrorKind::InvalidData, "request head too large"));
+    }
+    let mut chunk = [0u8; 4096];
+    let n = stream.read(&mut chunk).await?;
+    if n == 0 {
+      if buf.is_empty() {
+        return Ok(None);
+      }
+      return Err(std::io::Error::new(
+        std::io::ErrorKind::UnexpectedEof,
+        "connection closed mid-request",
+      ));
+    }
+    buf.extend_from_slice(&chunk[..n]);
+  };
+
+  let head = String::from_utf8_lossy(&buf[..head_end]).to_string();
+  let mut lines = head.split("\r\n");
+  let request_line = lines.next().unwrap_or("");
+  let mut parts = request_line.splitn(3, ' ');
+  let method = parts.next().unwrap_or("").to_string();
+  let target = parts.next().unwrap_or("").to_string();
+  let version = parts.next().unwrap_or("").to_string();
+
+  let mut headers = Vec::new();
+  for line in lines {
+    if line.is_empty() {
+      break;
+    }
+    if let Some((name, value)) = line.split_once(':') {
+      headers.push((name.to_string(), value.trim().to_string()));
+    }
+  }
+
+  let chunked = headers.iter().any(|(k, v)| {
+    k.eq_ignore_ascii_case("transfer-encoding") && v.to_lowercase().contains("chunked")
+  });
+  if chunked {
+    // A chunked request body is left for the route to consume incrementally; hand over any
+    // body bytes that arrived in the same reads as the head.
+    let request = Request {
+      method,
+      target,
+      version,
+      headers,
+      body: Vec::new(),
+      raw: buf[..head_end].to_vec(),
+      pending: buf[head_end..].to_vec(),
+      sni: None,
+    };
+    buf.clear();
+    return Ok(Some(request));
+  }
+
+  let expects_continue = headers
+    .iter()
+    .any(|(k, v)| k.eq_ignore_ascii_case("expect") && v.eq_ignore_ascii_case("100-continue"));
+  if expects_continue {
+    // A client honoring `Expect: 100-continue` withholds its body until it sees an interim
+    // response, so reading `Content-Length` bytes here would deadlock. Dispatch on the head
+    // alone and let the route decide whether to invite or reject the upload.
+    let request = Request {
+      method,
+      target,
+      version,
+      headers,
+      body: Vec::new(),
+      raw: buf[..head_end].to_vec(),
+      pending: buf[head_end..].to_vec(),
+      sni: None,
+    };
+    buf.clear();
+    return Ok(Some(request));
+  }
+
+  let content_length = headers
+    .iter()
+    .find(|(k, _)| k.eq_ignore_ascii_case("content-length"))
+    .and_then(|(_, v)| v.parse::<usize>().ok())
+    .unwrap_or(0);
+
+  while buf.len() < head_end + content_length {
+    let mut chunk = [0u8; 4096];
+    let n = stream.read(&mut chunk).await?;
+    if n == 0 {
+      return Err(std::io::Error::new(
+        std::io::ErrorKind::UnexpectedEof,
+        "connection closed mid-body",
+      ));
+    }
+    buf.extend_from_slice(&chunk[..n]);
+  }
+
+  let total = head_end + content_length;
+  let request = Request {
+    method,
+    target,
+    version,
+    headers,
+    body: buf[head_end..total].to_vec(),
+    raw: buf[..total].to_vec(),
+    pending: Vec::new(),
+    sni: None,
+  };
+  buf.drain(..total);
+  Ok(Some(request))
+}
+
+fn find_subsequence(haystack: &[u8], needle: &[u8]) -> Option<usize> {
+  haystack.windows(needle.len()).position(|window| window == needle)
+}
+
+/// Writes a well-framed HTTP/1.1 response. A `Content-Length` header is added automatically
+/// unless the caller supplied one (or is using `Transfer-Encoding`).
+pub async fn write_response<S: Stream>(
+  stream: &mut S,
+  status: u16,
+  reason: &str,
+  headers: &[(&str, &str)],
+  body: &[u8],
+) -> std::io::Result<()> {
+  let mut response = format!("HTTP/1.1 {} {}\r\n", status, reason);
+  let mut has_length = false;
+  for (name, value) in headers {
+    if name.eq_ignore_ascii_case("content-length") || name.eq_ignore_ascii_case("transfer-encoding")
+    {
+      has_length = true;
+    }
+    response.push_str(&format!("{}: {}\r\n", name, value));
+  }
+  if !has_length {
+    response.push_str(&format!("Content-Length: {}\r\n", body.len()));
+  }
+  response.push_str("\r\n");
+
+  stream.write_all(response.as_bytes()).await?;
+  stream.write_all(body).await?;
+  stream.flush().await
+}
+
+/// Writes a JSON response with the appropriate `Content-Type`.
+pub async fn write_json<S: Stream>(
+  stream: &mut S,
+  status: u16,
+  reason: &str,
+  value: &serde_json::Value,
+) -> std::io::Result<()> {
+  let body = serde_json::to_vec(value)?;
+  write_response(stream, status, reason, &[("Content-Type", "application/json")], &body).await
+}
@@ -0,0 +1,80 @@
+use clap::Parser;
+use tracing::{info, Level};
+use web_prover_mock_server::{sign::sign_target, MockServer, MockServerOptions};
+
+#[derive(Parser)]
+#[clap(name = "Mock Server")]
+#[clap(about = "A mock HTTP server for testing Web Proofs.", long_about = None)]
+struct Args {
+  #[clap(short, long, required = false, default_value = "DEBUG")]
+  log_level: String,
+
+  #[clap(short = 'L', long, required = false, default_value = "127.0.0.1:8085")]
+  listen: String,
+
+  /// Key used by /signed-url to validate HMAC-signed URLs.
+  #[clap(long, required = false, default_value = "")]
+  hmac_key: String,
+
+  /// Print a correctly signed URL for the given path+query (requires --hmac-key) and exit.
+  #[clap(long, required = false)]
+  sign: Option<String>,
+
+  /// Address for the TLS listener, served in addition to the plain one when --tls-cert and
+  /// --tls-key are given.
+  #[clap(long, required = false, default_value = "127.0.0.1:8443")]
+  tls_listen: String,
+
+  /// PEM certificate chain for the TLS listener.
+  #[clap(long, required = false)]
+  tls_cert: Option<String>,
+
+  /// PEM private key for the TLS listener.
+  #[clap(long, required = false)]
+  tls_key: Option<String>,
+
+  /// Milliseconds to hold back the first TLS handshake flight, for testing handshake-phase
+  /// client timeouts. 0 disables the delay.
+  #[clap(long, required = false, default_value = "0")]
+  tls_handshake_delay_ms: u64,
+
+  /// Cap every socket write at this many bytes so responses leave in many tiny segments,
+  /// stressing client reassembly. 0 disables the cap.
+  #[clap(long, required = false, default_value = "0")]
+  write_segment_bytes: usize,
+}
+
+#[tokio::main]
+async fn main() -> std::io::Result<()> {
+  let args = Args::parse();
+
+  let log_level = match args.log_level.to_lowercase().as_str() {
+    "error" => Level::ERROR,
+    "warn" => Level::WARN,
+    "info" => Level::INFO,
+    "debug" => Level::DEBUG,
+    "trace" => Level::TRACE,
+    _ => Level::TRACE,
+  };
+  tracing_subscriber::fmt().with_max_level(log_level).with_line_number(true).init();
+
+  if let Some(target) = args.sign {
+    println!("{}", sign_target(&target, args.hmac_key.as_bytes()));
+    return Ok(());
+  }
+
+  let options = MockServerOptions {
+    hmac_key:            args.hmac_key,
+    tls_handshake_delay: (args.tls_handshake_delay_ms > 0)
+      .then(|| std::time::Duration::from_millis(args.tls_handshake_delay_ms)),
+    write_segment_bytes: (args.write_segment_bytes > 0).then_some(args.write_segment_bytes),
+  };
+  if let (Some(cert), Some(key)) = (&args.tls_cert, &args.tls_key) {
+    let tls_server = MockServer::bind_tls(&args.tls_listen, cert, key, options.clone()).await?;
+    info!("Listening on https://{}", tls_server.local_addr()?);
+    tokio::spawn(tls_server.run());
+  }
+  let server = MockServer::bind_with_options(&args.listen, options).await?;
+  info!("Listening on http://{}", server.local_addr()?);
+  server.run().await
+}
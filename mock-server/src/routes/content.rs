@@ -0,0 +1,764 @@
+//! Routes that serve well-framed responses whose bodies or headers carry specific content
+//! shapes the prover needs to handle.
+
+use serde_json::json;
+
+use crate::{
+  sign::verify_target, write_json, write_response, Flow, MockServerOptions, Request, Stream,
+};
+
+/// `/method-echo`: consolidates method handling into one endpoint. GET returns a canned
+/// payload, POST (and PUT) reflect the request body, and DELETE returns 204 with no body;
+/// every non-204 response describes the method in JSON so tests can assert the distinction.
+pub async fn method_echo<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  match request.method.as_str() {
+    "DELETE" => write_response(stream, 204, "No Content", &[], b"").await?,
+    "GET" =>
+      write_json(stream, 200, "OK", &json!({ "method": "GET", "body": "canned GET payload" }))
+        .await?,
+    method =>
+      write_json(
+        stream,
+        200,
+        "OK",
+        &json!({
+          "method": method,
+          "body": String::from_utf8_lossy(&request.body),
+        }),
+      )
+      .await?,
+  }
+  Ok(Flow::KeepAlive)
+}
+
+/// `/bad-json?kind=truncated|trailing|nan`: serves malformed JSON under a
+/// `Content-Type: application/json` header so extractor error paths can be tested: an object
+/// truncated mid-value, trailing commas, or bare `NaN`/`Infinity` literals.
+pub async fn bad_json<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let body: &[u8] = match request.query("kind").unwrap_or("truncated") {
+    "trailing" => b"{\"a\": 1, \"b\": [1, 2,],}",
+    "nan" => b"{\"value\": NaN, \"limit\": Infinity}",
+    _ => b"{\"a\": 1, \"b\": {\"c\":",
+  };
+  write_response(stream, 200, "OK", &[("Content-Type", "application/json")], body).await?;
+  Ok(Flow::KeepAlive)
+}
+
+/// `/many-cookies?count=N`: emits `N` distinct `Set-Cookie` headers, modeling login flows
+/// that set a dozen cookies which the prover must capture in full in the transcript.
+pub async fn many_cookies<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let count: usize = request.query("count").and_then(|v| v.parse().ok()).unwrap_or(12).min(1000);
+  let cookies: Vec<String> =
+    (0..count).map(|i| format!("cookie_{}=value_{}; Path=/", i, i)).collect();
+  let headers: Vec<(&str, &str)> =
+    cookies.iter().map(|cookie| ("Set-Cookie", cookie.as_str())).collect();
+  write_response(stream, 200, "OK", &headers, b"cookies set").await?;
+  Ok(Flow::KeepAlive)
+}
+
+/// `/bad-redirect?empty=1`: returns a 302 with no `Location` header at all (or an empty one
+/// with `empty=1`). A correct client treats this as an error or a plain 302 body rather than
+/// crashing or following a redirect to nowhere.
+pub async fn bad_redirect<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  if request.query("empty") == Some("1") {
+    write_response(stream, 302, "Found", &[("Location", "")], b"redirect to nowhere").await?;
+  } else {
+    write_response(stream, 302, "Found", &[], b"redirect to nowhere").await?;
+  }
+  Ok(Flow::KeepAlive)
+}
+
+/// `/localized`: picks a body language from the `Accept-Language` header (English, Spanish,
+/// or Japanese, defaulting to English) and declares the choice in `Content-Language`, so the
+/// prover can be tested against responses that vary with request headers.
+pub async fn localized<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let accept = request.header("accept-language").unwrap_or("");
+  let language = accept
+    .split(',')
+    .map(|tag| tag.split(';').next().unwrap_or("").trim())
+    .find_map(|tag| {
+      ["en", "es", "ja"].iter().find(|supported| {
+        tag.eq_ignore_ascii_case(supported)
+          || tag.to_ascii_lowercase().starts_with(&format!("{}-", supported))
+      })
+    })
+    .copied()
+    .unwrap_or("en");
+
+  let body: &[u8] = match language {
+    "es" => "hola desde el servidor de prueba".as_bytes(),
+    "ja" => "テストサーバーからこんにちは".as_bytes(),
+    _ => b"hello from the mock server",
+  };
+  write_response(
+    stream,
+    200,
+    "OK",
+    &[("Content-Language", language), ("Content-Type", "text/plain; charset=utf-8")],
+    body,
+  )
+  .await?;
+  Ok(Flow::KeepAlive)
+}
+
+/// The `/binary-text` payload: null bytes, C0 control characters, a high-bit range, and
+/// ordinary text interleaved, so truncation at a null or mangling of control bytes anywhere
+/// in the pipeline shows up as a length or content mismatch.
+pub(crate) fn binary_text_payload() -> Vec<u8> {
+  let mut payload = Vec::new();
+  payload.extend_from_slice(b"before-null\x00after-null\x00\x00double");
+  payload.extend_from_slice(&[0x01, 0x02, 0x07, 0x08, 0x0b, 0x0c, 0x1b, 0x1f]);
+  payload.extend_from_slice(b"between-controls");
+  payload.extend_from_slice(&(0x80..=0xffu8).collect::<Vec<u8>>());
+  payload.extend_from_slice(b"trailing text");
+  payload
+}
+
+/// `/binary-text`: serves a body full of null bytes, control characters, and high-bit bytes
+/// under `Content-Type: text/plain` with a correct `Content-Length`. Real endpoints do emit
+/// binary-ish "text", and no layer of the prover may truncate at a null or rewrite control
+/// chars.
+pub async fn binary_text<S: Stream>(_request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let payload = binary_text_payload();
+  write_response(stream, 200, "OK", &[("Content-Type", "text/plain")], &payload).await?;
+  Ok(Flow::KeepAlive)
+}
+
+/// `/consume-then-respond`: responds only after the entire request body has arrived, with
+/// the SHA-256 of that body. Returning a digest rather than an echo proves the server
+/// consumed the complete upload before responding, which is the ordering some clients
+/// depend on.
+pub async fn consume_then_respond<S: Stream>(
+  request: &Request,
+  stream: &mut S,
+) -> std::io::Result<Flow> {
+  use sha2::{Digest, Sha256};
+  let digest = hex::encode(Sha256::digest(&request.body));
+  write_json(stream, 200, "OK", &json!({ "sha256": digest, "length": request.body.len() })).await?;
+  Ok(Flow::KeepAlive)
+}
+
+/// `/cdn?state=hit|miss`: models a CDN-fronted origin. A hit carries `X-Cache: HIT` with a
+/// non-zero `Age`; a miss carries `X-Cache: MISS` with `Age: 0`. Both return the same
+/// deterministic body under a `Cache-Control` header, since the caching headers — not the
+/// content — are what affects proof interpretation.
+pub async fn cdn<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let (cache, age) = match request.query("state").unwrap_or("miss") {
+    "hit" => ("HIT", "742"),
+    _ => ("MISS", "0"),
+  };
+  write_response(
+    stream,
+    200,
+    "OK",
+    &[
+      ("X-Cache", cache),
+      ("Age", age),
+      ("Cache-Control", "public, max-age=3600"),
+      ("Content-Type", "text/plain"),
+    ],
+    b"cdn fronted content",
+  )
+  .await?;
+  Ok(Flow::KeepAlive)
+}
+
+/// `/exact?len=N`: returns exactly `N` bytes of the `i % 256` sequence with a matching
+/// `Content-Length` — the canonical well-behaved response, for baseline tests that want an
+/// arbitrary-size body with nothing else going on.
+pub async fn exact<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let len: usize = request.query("len").and_then(|v| v.parse().ok()).unwrap_or(1024);
+  let len = len.min(64 * 1024 * 1024);
+  let body: Vec<u8> = (0..len).map(|i| (i % 256) as u8).collect();
+  write_response(stream, 200, "OK", &[], &body).await?;
+  Ok(Flow::KeepAlive)
+}
+
+/// Per-`key` request counters for `/grow`.
+fn grow_counters() -> &'static std::sync::Mutex<std::collections::HashMap<String, u64>> {
+  static COUNTERS: std::sync::OnceLock<std::sync::Mutex<std::collections::HashMap<String, u64>>> =
+    std::sync::OnceLock::new();
+  COUNTERS.get_or_init(|| std::sync::Mutex::new(std::collections::HashMap::new()))
+}
+
+/// `/grow?start=B&step=B&count=N&delay=MS&key=K`: returns a body of `start` bytes on the
+/// first request for `K`, growing by `step` on each subsequent one and plateauing after
+/// `count` requests. Escalating response sizes make allocation regressions in the prover
+/// visible as a memory trend rather than a single spike; `delay` spaces the growth out for
+/// profilers.
+pub async fn grow<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let start: u64 = request.query("start").and_then(|v| v.parse().ok()).unwrap_or(1024);
+  let step: u64 = request.query("step").and_then(|v| v.parse().ok()).unwrap_or(1024);
+  let count: u64 = request.query("count").and_then(|v| v.parse().ok()).unwrap_or(10).max(1);
+  let delay_ms: u64 = request.query("delay").and_then(|v| v.parse().ok()).unwrap_or(0);
+  let key = request.query("key").unwrap_or("default").to_string();
+
+  let seen = {
+    let mut counters = grow_counters().lock().unwrap();
+    let entry = counters.entry(key).or_insert(0);
+    let current = *entry;
+    *entry += 1;
+    current
+  };
+  if delay_ms > 0 {
+    tokio::time::sleep(std::time::Duration::from_millis(delay_ms)).await;
+  }
+
+  let size = (start + step * seen.min(count - 1)).min(64 * 1024 * 1024) as usize;
+  let body: Vec<u8> = (0..size).map(|i| (i % 256) as u8).collect();
+  let request_number = seen.to_string();
+  write_response(stream, 200, "OK", &[("X-Grow-Request", &request_number)], &body).await?;
+  Ok(Flow::KeepAlive)
+}
+
+/// Per-`key` request counters for `/warmup`.
+fn warmup_counters() -> &'static std::sync::Mutex<std::collections::HashMap<String, u64>> {
+  static COUNTERS: std::sync::OnceLock<std::sync::Mutex<std::collections::HashMap<String, u64>>> =
+    std::sync::OnceLock::new();
+  COUNTERS.get_or_init(|| std::sync::Mutex::new(std::collections::HashMap::new()))
+}
+
+/// `/warmup?ready_after=N&key=K`: models a cold-start endpoint. The first `N - 1` requests
+/// for `K` get 503 with a `Retry-After` hint; from the `N`th on the route is warm and
+/// serves 200. Retry loops in the client can be exercised against a service that genuinely
+/// becomes ready, rather than one that merely flaps.
+pub async fn warmup<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let ready_after: u64 =
+    request.query("ready_after").and_then(|v| v.parse().ok()).unwrap_or(3).max(1);
+  let key = request.query("key").unwrap_or("default").to_string();
+
+  let seen = {
+    let mut counters = warmup_counters().lock().unwrap();
+    let entry = counters.entry(key).or_insert(0);
+    *entry += 1;
+    *entry
+  };
+  if seen < ready_after {
+    let headers = [("Retry-After", "1")];
+    write_response(stream, 503, "Service Unavailable", &headers, b"warming up").await?;
+  } else {
+    write_response(stream, 200, "OK", &[], b"warm").await?;
+  }
+  Ok(Flow::KeepAlive)
+}
+
+/// Per-`key` request counters for `/captive`.
+fn captive_counters() -> &'static std::sync::Mutex<std::collections::HashMap<String, u64>> {
+  static COUNTERS: std::sync::OnceLock<std::sync::Mutex<std::collections::HashMap<String, u64>>> =
+    std::sync::OnceLock::new();
+  COUNTERS.get_or_init(|| std::sync::Mutex::new(std::collections::HashMap::new()))
+}
+
+/// `/captive?key=K`: models a captive-portal network. The first request for `K` is hijacked
+/// with a 302 to the `/portal` interstitial; every request after that serves the real
+/// content, as a portal does once the client has been let through. Tests use this to verify
+/// the prover surfaces an unexpected redirect mid-notarization instead of silently
+/// following it.
+pub async fn captive<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let key = request.query("key").unwrap_or("default").to_string();
+  let seen = {
+    let mut counters = captive_counters().lock().unwrap();
+    let entry = counters.entry(key.clone()).or_insert(0);
+    *entry += 1;
+    *entry
+  };
+  if seen == 1 {
+    let location = format!("/portal?key={}", key);
+    write_response(stream, 302, "Found", &[("Location", &location)], b"redirecting to portal")
+      .await?;
+  } else {
+    write_response(stream, 200, "OK", &[("Content-Type", "text/plain")], b"the real content")
+      .await?;
+  }
+  Ok(Flow::KeepAlive)
+}
+
+/// `/portal`: the interstitial page `/captive` redirects to — the static login page a real
+/// portal would show before granting access.
+pub async fn portal<S: Stream>(_request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  write_response(
+    stream,
+    200,
+    "OK",
+    &[("Content-Type", "text/html")],
+    b"<html><body><h1>Network login</h1><p>Sign in to continue.</p></body></html>",
+  )
+  .await?;
+  Ok(Flow::KeepAlive)
+}
+
+/// Cap on the issued-nonce history for `/nonce-response`; old nonces age out so state stays
+/// bounded no matter how long the server runs.
+const NONCE_HISTORY_CAP: usize = 128;
+
+/// Issued nonces for `/nonce-response`, most recent at the back.
+fn issued_nonces() -> &'static std::sync::Mutex<std::collections::VecDeque<String>> {
+  static NONCES: std::sync::OnceLock<std::sync::Mutex<std::collections::VecDeque<String>>> =
+    std::sync::OnceLock::new();
+  NONCES.get_or_init(|| std::sync::Mutex::new(std::collections::VecDeque::new()))
+}
+
+/// `/nonce-response`: models an anti-replay API. Every response embeds a fresh nonce;
+/// echoing a previously-issued nonce back via `X-Nonce` is rejected with 409, so a prover
+/// that reuses a stale response (and with it a stale nonce) fails loudly.
+pub async fn nonce_response<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  if let Some(presented) = request.header("X-Nonce") {
+    let replayed = issued_nonces().lock().unwrap().iter().any(|nonce| nonce == presented);
+    if replayed {
+      write_response(stream, 409, "Conflict", &[], b"nonce replayed").await?;
+      return Ok(Flow::KeepAlive);
+    }
+  }
+
+  let nanos = std::time::SystemTime::now()
+    .duration_since(std::time::UNIX_EPOCH)
+    .unwrap_or_default()
+    .as_nanos();
+  let nonce = format!("{:032x}", nanos);
+  {
+    let mut nonces = issued_nonces().lock().unwrap();
+    nonces.push_back(nonce.clone());
+    while nonces.len() > NONCE_HISTORY_CAP {
+      nonces.pop_front();
+    }
+  }
+  write_json(stream, 200, "OK", &json!({ "nonce": nonce })).await?;
+  Ok(Flow::KeepAlive)
+}
+
+/// Per-`id` state for `/resource`: the current version (which doubles as the ETag) and body.
+fn resources() -> &'static std::sync::Mutex<std::collections::HashMap<String, (u64, Vec<u8>)>> {
+  static RESOURCES: std::sync::OnceLock<
+    std::sync::Mutex<std::collections::HashMap<String, (u64, Vec<u8>)>>,
+  > = std::sync::OnceLock::new();
+  RESOURCES.get_or_init(|| std::sync::Mutex::new(std::collections::HashMap::new()))
+}
+
+/// `/resource?id=K`: a stateful REST resource with optimistic concurrency. GET returns the
+/// current body with an `ETag`; PUT must carry `If-Match` with the current ETag and gets 409
+/// on a stale one, or 200 with the new ETag on success. State is keyed by `id` so concurrent
+/// tests don't interfere.
+pub async fn resource<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let id = request.query("id").unwrap_or("default").to_string();
+  match request.method.as_str() {
+    "GET" => {
+      let (version, body) = {
+        let mut map = resources().lock().unwrap();
+        map.entry(id).or_insert_with(|| (1, b"initial resource state".to_vec())).clone()
+      };
+      let etag = format!("\"v{}\"", version);
+      write_response(stream, 200, "OK", &[("ETag", &etag)], &body).await?;
+    },
+    "PUT" => {
+      let presented = match request.header("If-Match") {
+        Some(value) => value.to_string(),
+        None => {
+          write_response(stream, 428, "Precondition Required", &[], b"If-Match required").await?;
+          return Ok(Flow::KeepAlive);
+        },
+      };
+      let updated = {
+        let mut map = resources().lock().unwrap();
+        let entry = map.entry(id).or_insert_with(|| (1, b"initial resource state".to_vec()));
+        if presented == format!("\"v{}\"", entry.0) {
+          entry.0 += 1;
+          entry.1 = request.body.clone();
+          Some(entry.0)
+        } else {
+          None
+        }
+      };
+      match updated {
+        Some(version) => {
+          let etag = format!("\"v{}\"", version);
+          write_response(stream, 200, "OK", &[("ETag", &etag)], b"updated").await?;
+        },
+        None => write_response(stream, 409, "Conflict", &[], b"stale etag").await?,
+      }
+    },
+    _ => write_response(stream, 405, "Method Not Allowed", &[], b"use GET or PUT").await?,
+  }
+  Ok(Flow::KeepAlive)
+}
+
+/// `/raw-request`: returns the exact bytes of the request as they arrived on the wire —
+/// request line, headers with their original casing and order, and body — so tests can
+/// assert what the prover actually sent rather than what it meant to send.
+pub async fn raw_request<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  write_response(stream, 200, "OK", &[("Content-Type", "application/octet-stream")], &request.raw)
+    .await?;
+  Ok(Flow::KeepAlive)
+}
+
+/// `/sni`: echoes back the TLS server name (SNI) the connection presented, as JSON; the
+/// value is `null` over plain TCP. Notarization integrity can depend on the SNI matching the
+/// URL host, so tests use this to verify what the prover actually sent in its ClientHello.
+pub async fn sni<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  write_json(stream, 200, "OK", &json!({ "server_name": request.sni })).await?;
+  Ok(Flow::KeepAlive)
+}
+
+/// `/signed-url`: validates an HMAC-SHA256 signature over the request target (see
+/// [`crate::sign`]), returning 200 on a valid signature and 403 otherwise. The key comes
+/// from [`MockServerOptions::hmac_key`]; the route is disabled when no key is configured.
+pub async fn signed_url<S: Stream>(
+  request: &Request,
+  stream: &mut S,
+  options: &MockServerOptions,
+) -> std::io::Result<Flow> {
+  if options.hmac_key.is_empty() {
+    write_response(stream, 500, "Internal Server Error", &[], b"hmac key not configured").await?;
+    return Ok(Flow::KeepAlive);
+  }
+  if verify_target(&request.target, options.hmac_key.as_bytes()) {
+    write_response(stream, 200, "OK", &[], b"signature accepted").await?;
+  } else {
+    write_response(stream, 403, "Forbidden", &[], b"bad signature").await?;
+  }
+  Ok(Flow::KeepAlive)
+}
+
+#[cfg(test)]
+mod tests {
+  use crate::test_utils::{roundtrip, start_server};
+
+  #[tokio::test]
+  async fn exact_returns_precisely_the_requested_length() {
+    let addr = start_server().await;
+    for len in [0usize, 1, 255, 256, 4096] {
+      let request = format!("GET /exact?len={} HTTP/1.1\r\nHost: localhost\r\n\r\n", len);
+      let (head, body) = roundtrip(addr, request.as_bytes()).await;
+      assert!(head.starts_with("HTTP/1.1 200"));
+      assert!(head.contains(&format!("Content-Length: {}\r\n", len)));
+      assert_eq!(body.len(), len);
+      assert!(body.iter().enumerate().all(|(i, b)| *b == (i % 256) as u8));
+    }
+  }
+
+  #[tokio::test]
+  async fn each_method_gets_a_distinct_response() {
+    let addr = start_server().await;
+
+    let (head, body) =
+      roundtrip(addr, b"GET /method-echo HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+    assert!(head.starts_with("HTTP/1.1 200"));
+    let json: serde_json::Value = serde_json::from_slice(&body).unwrap();
+    assert_eq!(json["method"], "GET");
+    assert_eq!(json["body"], "canned GET payload");
+
+    let (head, body) = roundtrip(
+      addr,
+      b"POST /method-echo HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello",
+    )
+    .await;
+    assert!(head.starts_with("HTTP/1.1 200"));
+    let json: serde_json::Value = serde_json::from_slice(&body).unwrap();
+    assert_eq!(json["method"], "POST");
+    assert_eq!(json["body"], "hello");
+
+    let (head, body) = roundtrip(
+      addr,
+      b"PUT /method-echo HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\n\r\nput",
+    )
+    .await;
+    assert!(head.starts_with("HTTP/1.1 200"));
+    let json: serde_json::Value = serde_json::from_slice(&body).unwrap();
+    assert_eq!(json["method"], "PUT");
+    assert_eq!(json["body"], "put");
+
+    let (head, body) =
+      roundtrip(addr, b"DELETE /method-echo HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+    assert!(head.starts_with("HTTP/1.1 204"));
+    assert!(body.is_empty());
+  }
+
+  #[tokio::test]
+  async fn many_cookies_emits_the_requested_number_of_distinct_headers() {
+    let addr = start_server().await;
+    let (head, _) =
+      roundtrip(addr, b"GET /many-cookies?count=17 HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+
+    let cookies: Vec<&str> = head.lines().filter(|line| line.starts_with("Set-Cookie: ")).collect();
+    assert_eq!(cookies.len(), 17);
+    let distinct: std::collections::HashSet<&str> = cookies.iter().copied().collect();
+    assert_eq!(distinct.len(), 17);
+  }
+
+  #[tokio::test]
+  async fn signed_url_accepts_valid_and_rejects_tampered_signatures() {
+    let addr = crate::test_utils::start_server_with_options(crate::MockServerOptions {
+      hmac_key: "test-key".to_string(),
+      ..Default::default()
+    })
+    .await;
+
+    let target = crate::sign::sign_target("/signed-url?user=42", b"test-key");
+    let request = format!("GET {} HTTP/1.1\r\nHost: localhost\r\n\r\n", target);
+    let (head, _) = roundtrip(addr, request.as_bytes()).await;
+    assert!(head.starts_with("HTTP/1.1 200"));
+
+    let tampered = target.replace("user=42", "user=43");
+    let request = format!("GET {} HTTP/1.1\r\nHost: localhost\r\n\r\n", tampered);
+    let (head, _) = roundtrip(addr, request.as_bytes()).await;
+    assert!(head.starts_with("HTTP/1.1 403"));
+  }
+
+  #[tokio::test]
+  async fn bad_redirect_has_no_location_unless_an_empty_one_is_requested() {
+    let addr = start_server().await;
+
+    let (head, _) = roundtrip(addr, b"GET /bad-redirect HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+    assert!(head.starts_with("HTTP/1.1 302"));
+    assert!(!head.to_lowercase().contains("location"));
+
+    let (head, _) =
+      roundtrip(addr, b"GET /bad-redirect?empty=1 HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+    assert!(head.starts_with("HTTP/1.1 302"));
+    assert!(head.contains("Location: \r\n"));
+  }
+
+  #[tokio::test]
+  async fn localized_picks_the_language_and_declares_it() {
+    let addr = start_server().await;
+
+    for (accept, language, marker) in [
+      ("es-MX,es;q=0.9,en;q=0.8", "es", "hola"),
+      ("ja", "ja", "こんにちは"),
+      ("fr-FR,de;q=0.7", "en", "hello"),
+      ("", "en", "hello"),
+    ] {
+      let request = format!(
+        "GET /localized HTTP/1.1\r\nHost: localhost\r\nAccept-Language: {}\r\n\r\n",
+        accept
+      );
+      let (head, body) = roundtrip(addr, request.as_bytes()).await;
+      let body = String::from_utf8(body).unwrap();
+
+      assert!(head.starts_with("HTTP/1.1 200"), "accept={}", accept);
+      assert!(head.contains(&format!("Content-Language: {}", language)), "accept={}", accept);
+      assert!(body.contains(marker), "accept={} body={}", accept, body);
+    }
+  }
+
+  #[tokio::test]
+  async fn sni_is_reflected_over_tls_and_null_over_plain_tcp() {
+    let tls_addr = crate::test_utils::start_tls_server().await;
+    let (head, body) = crate::test_utils::tls_roundtrip(
+      tls_addr,
+      "prover.test.example",
+      b"GET /sni HTTP/1.1\r\nHost: prover.test.example\r\n\r\n",
+    )
+    .await;
+    assert!(head.starts_with("HTTP/1.1 200"));
+    let json: serde_json::Value = serde_json::from_slice(&body).unwrap();
+    assert_eq!(json["server_name"], "prover.test.example");
+
+    let addr = start_server().await;
+    let (_, body) = roundtrip(addr, b"GET /sni HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+    let json: serde_json::Value = serde_json::from_slice(&body).unwrap();
+    assert_eq!(json["server_name"], serde_json::Value::Null);
+  }
+
+  #[tokio::test]
+  async fn replayed_nonces_conflict_while_fresh_fetches_succeed() {
+    let addr = start_server().await;
+
+    let (head, body) =
+      roundtrip(addr, b"GET /nonce-response HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+    assert!(head.starts_with("HTTP/1.1 200"));
+    let json: serde_json::Value = serde_json::from_slice(&body).unwrap();
+    let nonce = json["nonce"].as_str().unwrap().to_string();
+
+    let replay =
+      format!("GET /nonce-response HTTP/1.1\r\nHost: localhost\r\nX-Nonce: {}\r\n\r\n", nonce);
+    let (head, _) = roundtrip(addr, replay.as_bytes()).await;
+    assert!(head.starts_with("HTTP/1.1 409"));
+
+    let (head, body) =
+      roundtrip(addr, b"GET /nonce-response HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+    assert!(head.starts_with("HTTP/1.1 200"));
+    let json: serde_json::Value = serde_json::from_slice(&body).unwrap();
+    assert_ne!(json["nonce"].as_str().unwrap(), nonce);
+  }
+
+  #[tokio::test]
+  async fn grow_bodies_escalate_by_step_and_plateau_at_count() {
+    let addr = start_server().await;
+    let request =
+      b"GET /grow?start=100&step=50&count=3&key=grow-test HTTP/1.1\r\nHost: localhost\r\n\r\n";
+
+    let mut sizes = Vec::new();
+    for _ in 0..4 {
+      let (head, body) = roundtrip(addr, request).await;
+      assert!(head.starts_with("HTTP/1.1 200"));
+      sizes.push(body.len());
+    }
+    // Growth stops after `count` requests; the fourth response repeats the third's size.
+    assert_eq!(sizes, vec![100, 150, 200, 200]);
+  }
+
+  #[tokio::test]
+  async fn warmup_serves_errors_until_the_nth_request_then_stays_ready() {
+    let addr = start_server().await;
+    let request = b"GET /warmup?ready_after=3&key=warmup-test HTTP/1.1\r\nHost: localhost\r\n\r\n";
+
+    for _ in 0..2 {
+      let (head, body) = roundtrip(addr, request).await;
+      assert!(head.starts_with("HTTP/1.1 503"));
+      assert!(head.contains("Retry-After: 1\r\n"));
+      assert_eq!(body, b"warming up");
+    }
+    // The third request finds the endpoint warm, and it stays warm afterwards.
+    for _ in 0..2 {
+      let (head, body) = roundtrip(addr, request).await;
+      assert!(head.starts_with("HTTP/1.1 200"));
+      assert_eq!(body, b"warm");
+    }
+  }
+
+  #[tokio::test]
+  async fn captive_redirects_the_first_request_then_serves_the_real_content() {
+    let addr = start_server().await;
+    let request = b"GET /captive?key=captive-test HTTP/1.1\r\nHost: localhost\r\n\r\n";
+
+    // First hop: hijacked to the portal interstitial.
+    let (head, _) = roundtrip(addr, request).await;
+    assert!(head.starts_with("HTTP/1.1 302"));
+    assert!(head.contains("Location: /portal?key=captive-test\r\n"));
+
+    // The portal page itself is reachable.
+    let (head, body) =
+      roundtrip(addr, b"GET /portal?key=captive-test HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+    assert!(head.starts_with("HTTP/1.1 200"));
+    assert!(String::from_utf8(body).unwrap().contains("Network login"));
+
+    // Once through the portal, the real content is served and stays served.
+    for _ in 0..2 {
+      let (head, body) = roundtrip(addr, request).await;
+      assert!(head.starts_with("HTTP/1.1 200"));
+      assert_eq!(body, b"the real content");
+    }
+  }
+
+  #[tokio::test]
+  async fn binary_text_body_arrives_byte_exact() {
+    let addr = start_server().await;
+    let (head, body) =
+      roundtrip(addr, b"GET /binary-text HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+
+    let expected = super::binary_text_payload();
+    assert!(head.starts_with("HTTP/1.1 200"));
+    assert!(head.contains("Content-Type: text/plain"));
+    assert!(head.contains(&format!("Content-Length: {}", expected.len())));
+    assert_eq!(body, expected);
+  }
+
+  #[tokio::test]
+  async fn consume_then_respond_hashes_the_complete_upload() {
+    use sha2::{Digest, Sha256};
+
+    let addr = start_server().await;
+    let body: Vec<u8> = (0..10_000u32).map(|i| (i % 251) as u8).collect();
+    let mut request = format!(
+      "POST /consume-then-respond HTTP/1.1\r\nHost: localhost\r\nContent-Length: {}\r\n\r\n",
+      body.len()
+    )
+    .into_bytes();
+    request.extend_from_slice(&body);
+
+    let (head, response) = roundtrip(addr, &request).await;
+    assert!(head.starts_with("HTTP/1.1 200"));
+    let json: serde_json::Value = serde_json::from_slice(&response).unwrap();
+    assert_eq!(json["sha256"], hex::encode(Sha256::digest(&body)));
+    assert_eq!(json["length"], body.len());
+  }
+
+  #[tokio::test]
+  async fn cdn_states_carry_the_matching_cache_headers() {
+    let addr = start_server().await;
+
+    let (head, body) =
+      roundtrip(addr, b"GET /cdn?state=hit HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+    assert!(head.contains("X-Cache: HIT"));
+    assert!(head.contains("Age: 742"));
+    assert!(head.contains("Cache-Control: public, max-age=3600"));
+    assert_eq!(body, b"cdn fronted content");
+
+    let (head, body) =
+      roundtrip(addr, b"GET /cdn?state=miss HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+    assert!(head.contains("X-Cache: MISS"));
+    assert!(head.contains("Age: 0"));
+    assert_eq!(body, b"cdn fronted content");
+  }
+
+  #[tokio::test]
+  async fn resource_put_succeeds_with_the_current_etag_and_conflicts_on_a_stale_one() {
+    let addr = start_server().await;
+
+    let (head, body) =
+      roundtrip(addr, b"GET /resource?id=occ-test HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+    assert!(head.starts_with("HTTP/1.1 200"));
+    assert_eq!(body, b"initial resource state");
+    let etag = head
+      .lines()
+      .find_map(|line| line.strip_prefix("ETag: "))
+      .expect("GET must return an ETag")
+      .to_string();
+
+    let put = format!(
+      "PUT /resource?id=occ-test HTTP/1.1\r\nHost: localhost\r\nIf-Match: {}\r\nContent-Length: \
+       7\r\n\r\nupdated",
+      etag
+    );
+    let (head, _) = roundtrip(addr, put.as_bytes()).await;
+    assert!(head.starts_with("HTTP/1.1 200"));
+    let new_etag = head.lines().find_map(|line| line.strip_prefix("ETag: ")).unwrap().to_string();
+    assert_ne!(new_etag, etag);
+
+    // Replaying the original ETag now loses the optimistic-concurrency race.
+    let stale = format!(
+      "PUT /resource?id=occ-test HTTP/1.1\r\nHost: localhost\r\nIf-Match: {}\r\nContent-Length: \
+       5\r\n\r\nstale",
+      etag
+    );
+    let (head, _) = roundtrip(addr, stale.as_bytes()).await;
+    assert!(head.starts_with("HTTP/1.1 409"));
+
+    let (_, body) =
+      roundtrip(addr, b"GET /resource?id=occ-test HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+    assert_eq!(body, b"updated");
+  }
+
+  #[tokio::test]
+  async fn raw_request_returns_the_exact_bytes_sent() {
+    let addr = start_server().await;
+
+    // Odd header casing, ordering, and stray spacing must all come back verbatim — the point
+    // of the route is to show the true wire bytes, not a normalized reconstruction.
+    let wire = b"POST /raw-request?x=1 HTTP/1.1\r\nhOsT: localhost\r\n\
+      X-ODD-Header:  spaced\r\nContent-Length: 4\r\n\r\nbody";
+    let (head, body) = roundtrip(addr, wire).await;
+
+    assert!(head.starts_with("HTTP/1.1 200"));
+    assert!(head.contains("Content-Type: application/octet-stream"));
+    assert_eq!(body, wire);
+  }
+
+  #[tokio::test]
+  async fn bad_json_variants_are_served_as_declared() {
+    let addr = start_server().await;
+
+    for (kind, marker) in
+      [("truncated", "{\"a\": 1, \"b\": {\"c\":"), ("trailing", "[1, 2,],}"), ("nan", "NaN")]
+    {
+      let request = format!("GET /bad-json?kind={} HTTP/1.1\r\nHost: localhost\r\n\r\n", kind);
+      let (head, body) = roundtrip(addr, request.as_bytes()).await;
+      let body = String::from_utf8(body).unwrap();
+
+      assert!(head.starts_with("HTTP/1.1 200"), "kind={}", kind);
+      assert!(head.contains("Content-Type: application/json"), "kind={}", kind);
+      assert!(body.contains(marker), "kind={} body={}", kind, body);
+      assert!(serde_json::from_str::<serde_json::Value>(&body).is_err(), "kind={}", kind);
+    }
+  }
+}
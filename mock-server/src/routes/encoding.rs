@@ -0,0 +1,106 @@
+//! Routes exercising content-encoding edge cases: compressed bodies with missing or
+//! ambiguous encoding declarations.
+
+use std::io::Write;
+
+use flate2::{
+  write::{DeflateEncoder, GzEncoder, ZlibEncoder},
+  Compression,
+};
+
+use crate::{write_response, Flow, Request, Stream};
+
+/// `/gzip-undeclared`: returns gzip-compressed bytes but deliberately omits the
+/// `Content-Encoding` header, declaring only `Content-Type: application/octet-stream`. A
+/// correct prover should treat the body as opaque bytes rather than auto-decompressing on
+/// magic bytes.
+pub async fn gzip_undeclared<S: Stream>(
+  _request: &Request,
+  stream: &mut S,
+) -> std::io::Result<Flow> {
+  let body = gzip(b"this payload is gzipped but the headers do not say so");
+  write_response(stream, 200, "OK", &[("Content-Type", "application/octet-stream")], &body).await?;
+  Ok(Flow::KeepAlive)
+}
+
+/// `/deflate?raw=0|1`: serves a `Content-Encoding: deflate` body as either zlib-wrapped
+/// (`raw=0`, the RFC meaning) or raw DEFLATE (`raw=1`, what some servers actually send).
+/// Browsers and servers disagree on which `deflate` means, so the prover must cope with
+/// both interpretations.
+pub async fn deflate<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let payload = b"this payload is deflate-encoded, in one of the two senses of the word";
+  let body = if request.query("raw") == Some("1") {
+    let mut encoder = DeflateEncoder::new(Vec::new(), Compression::default());
+    encoder.write_all(payload).expect("writing to a Vec cannot fail");
+    encoder.finish().expect("writing to a Vec cannot fail")
+  } else {
+    let mut encoder = ZlibEncoder::new(Vec::new(), Compression::default());
+    encoder.write_all(payload).expect("writing to a Vec cannot fail");
+    encoder.finish().expect("writing to a Vec cannot fail")
+  };
+  write_response(
+    stream,
+    200,
+    "OK",
+    &[("Content-Type", "text/plain"), ("Content-Encoding", "deflate")],
+    &body,
+  )
+  .await?;
+  Ok(Flow::KeepAlive)
+}
+
+pub(crate) fn gzip(data: &[u8]) -> Vec<u8> {
+  let mut encoder = GzEncoder::new(Vec::new(), Compression::default());
+  encoder.write_all(data).expect("writing to a Vec cannot fail");
+  encoder.finish().expect("writing to a Vec cannot fail")
+}
+
+#[cfg(test)]
+mod tests {
+  use std::io::Read;
+
+  use flate2::read::{DeflateDecoder, GzDecoder, ZlibDecoder};
+
+  use crate::test_utils::{roundtrip, start_server};
+
+  #[tokio::test]
+  async fn deflate_serves_zlib_by_default_and_raw_deflate_on_request() {
+    let addr = start_server().await;
+    let expected = "this payload is deflate-encoded, in one of the two senses of the word";
+
+    let (head, body) = roundtrip(addr, b"GET /deflate HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+    assert!(head.contains("Content-Encoding: deflate"));
+    // The zlib variant carries the two-byte zlib header (0x78 ...).
+    assert_eq!(body[0], 0x78);
+    let mut decoded = String::new();
+    ZlibDecoder::new(body.as_slice()).read_to_string(&mut decoded).unwrap();
+    assert_eq!(decoded, expected);
+
+    let (head, body) =
+      roundtrip(addr, b"GET /deflate?raw=1 HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+    assert!(head.contains("Content-Encoding: deflate"));
+    let mut decoded = String::new();
+    DeflateDecoder::new(body.as_slice()).read_to_string(&mut decoded).unwrap();
+    assert_eq!(decoded, expected);
+    // And the raw variant is not valid zlib.
+    let mut bogus = String::new();
+    assert!(ZlibDecoder::new(body.as_slice()).read_to_string(&mut bogus).is_err());
+  }
+
+  #[tokio::test]
+  async fn gzip_undeclared_serves_raw_gzip_bytes_without_the_encoding_header() {
+    let addr = start_server().await;
+    let (head, body) =
+      roundtrip(addr, b"GET /gzip-undeclared HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+
+    assert!(head.starts_with("HTTP/1.1 200"));
+    assert!(head.contains("Content-Type: application/octet-stream"));
+    assert!(!head.to_lowercase().contains("content-encoding"));
+
+    // The gzip magic bytes are on the wire, and the body round-trips through a decoder.
+    assert_eq!(&body[..2], &[0x1f, 0x8b]);
+    let mut decoded = String::new();
+    GzDecoder::new(body.as_slice()).read_to_string(&mut decoded).unwrap();
+    assert_eq!(decoded, "this payload is gzipped but the headers do not say so");
+  }
+}
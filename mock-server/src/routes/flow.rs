@@ -0,0 +1,185 @@
+//! Routes that exercise connection-lifecycle behavior: keep-alive, reuse, and
+//! server-initiated closes.
+
+use std::time::Duration;
+
+use tokio::io::AsyncWriteExt;
+
+use crate::{read_request, write_response, Flow, Request, Stream};
+
+/// `/keepalive-idle?idle=MS`: returns a normal keep-alive response, keeps serving requests
+/// that arrive within the idle window, and closes the connection once it has been idle for
+/// the configured duration. Lets the prover test connection reuse under server-initiated
+/// idle close.
+pub async fn keepalive_idle<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let idle_ms: u64 = request.query("idle").and_then(|v| v.parse().ok()).unwrap_or(100);
+  write_response(stream, 200, "OK", &[("Connection", "keep-alive")], b"keep-alive body").await?;
+
+  let mut buf = Vec::new();
+  loop {
+    match tokio::time::timeout(Duration::from_millis(idle_ms), read_request(stream, &mut buf)).await
+    {
+      // The idle window elapsed without another request; the server closes.
+      Err(_) => return Ok(Flow::Close),
+      Ok(Ok(Some(_))) =>
+        write_response(stream, 200, "OK", &[("Connection", "keep-alive")], b"keep-alive body")
+          .await?,
+      // Client closed or sent garbage; either way the connection is done.
+      Ok(_) => return Ok(Flow::Close),
+    }
+  }
+}
+
+/// `/force-close`: returns a small body with an explicit `Connection: close` and then closes
+/// the TCP connection, modeling single-shot servers. A correct client must open a fresh
+/// connection for its next request; `test_utils::assert_closed` is the companion check for
+/// the old one.
+pub async fn force_close<S: Stream>(_request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  write_response(stream, 200, "OK", &[("Connection", "close")], b"single-shot response").await?;
+  Ok(Flow::Close)
+}
+
+/// `/reject-upload`: for requests carrying `Expect: 100-continue`, rejects the upload with
+/// 417 Expectation Failed without ever inviting (or reading) the body — no interim 100 is
+/// written. A correct prover aborts the upload on the final response instead of blocking on
+/// the withheld body. The response is written raw so nothing resembling an interim status
+/// sneaks onto the wire, and the connection closes because the declared body was never
+/// consumed. Requests without the header get a plain 200 so the route can be probed.
+pub async fn reject_upload<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let expects_continue =
+    request.header("Expect").is_some_and(|v| v.eq_ignore_ascii_case("100-continue"));
+  if !expects_continue {
+    write_response(stream, 200, "OK", &[], b"no expectation").await?;
+    return Ok(Flow::KeepAlive);
+  }
+
+  let body = "expectation failed";
+  let response = format!(
+    "HTTP/1.1 417 Expectation Failed\r\nContent-Length: {}\r\nConnection: close\r\n\r\n{}",
+    body.len(),
+    body
+  );
+  stream.write_all(response.as_bytes()).await?;
+  Ok(Flow::Close)
+}
+
+/// `/pipeline-marker?n=K`: echoes the client-chosen marker `K` in the body. Clients drive
+/// this by sending several pipelined requests with distinct markers on one connection and
+/// asserting the responses come back in request order, which the server guarantees by
+/// serving each connection sequentially.
+pub async fn pipeline_marker<S: Stream>(
+  request: &Request,
+  stream: &mut S,
+) -> std::io::Result<Flow> {
+  let marker = request.query("n").unwrap_or("0");
+  let body = format!("marker: {}", marker);
+  write_response(stream, 200, "OK", &[], body.as_bytes()).await?;
+  Ok(Flow::KeepAlive)
+}
+
+#[cfg(test)]
+mod tests {
+  use tokio::{
+    io::{AsyncReadExt, AsyncWriteExt},
+    net::TcpStream,
+  };
+
+  use crate::test_utils::{assert_closed, read_response, start_server};
+
+  #[tokio::test]
+  async fn pipelined_requests_are_answered_in_order() {
+    let addr = start_server().await;
+    let mut stream = TcpStream::connect(addr).await.unwrap();
+
+    // Two requests back to back, before reading anything: the second is buffered while the
+    // first is being served.
+    stream
+      .write_all(
+        b"GET /pipeline-marker?n=1 HTTP/1.1\r\nHost: localhost\r\n\r\nGET /pipeline-marker?n=2 \
+          HTTP/1.1\r\nHost: localhost\r\n\r\n",
+      )
+      .await
+      .unwrap();
+
+    // Both responses may arrive in one read, so collect the stream until the second body is
+    // complete and assert ordering on the combined bytes.
+    let mut buf = Vec::new();
+    while !buf.windows(9).any(|w| w == b"marker: 2") {
+      let mut chunk = [0u8; 4096];
+      let n = stream.read(&mut chunk).await.unwrap();
+      assert!(n > 0, "connection closed before both responses arrived");
+      buf.extend_from_slice(&chunk[..n]);
+    }
+    let text = String::from_utf8(buf).unwrap();
+    assert_eq!(text.matches("HTTP/1.1 200").count(), 2);
+    assert!(
+      text.find("marker: 1").unwrap() < text.find("marker: 2").unwrap(),
+      "responses out of order: {}",
+      text
+    );
+  }
+
+  #[tokio::test]
+  async fn force_close_ends_the_connection_and_a_new_request_needs_a_fresh_one() {
+    let addr = start_server().await;
+    let mut first = TcpStream::connect(addr).await.unwrap();
+    first.write_all(b"GET /force-close HTTP/1.1\r\nHost: localhost\r\n\r\n").await.unwrap();
+
+    let (head, body) = read_response(&mut first).await;
+    assert!(head.starts_with("HTTP/1.1 200"));
+    assert!(head.contains("Connection: close"));
+    assert_eq!(body, b"single-shot response");
+    assert_closed(&mut first).await;
+
+    // The follow-up request succeeds only because it is made on a new connection.
+    let mut second = TcpStream::connect(addr).await.unwrap();
+    second.write_all(b"GET /health HTTP/1.1\r\nHost: localhost\r\n\r\n").await.unwrap();
+    let (head, _) = read_response(&mut second).await;
+    assert!(head.starts_with("HTTP/1.1 200"));
+  }
+
+  #[tokio::test]
+  async fn upload_is_rejected_before_any_body_byte_is_sent() {
+    let addr = start_server().await;
+    let mut stream = TcpStream::connect(addr).await.unwrap();
+
+    // Head only: a client honoring Expect: 100-continue withholds its declared body until
+    // the server responds. The 417 must arrive while the body is still unsent.
+    stream
+      .write_all(
+        b"POST /reject-upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: \
+          1000000\r\nExpect: 100-continue\r\n\r\n",
+      )
+      .await
+      .unwrap();
+
+    let (head, body) = read_response(&mut stream).await;
+    assert!(head.starts_with("HTTP/1.1 417"), "unexpected response: {}", head);
+    assert!(!head.contains("HTTP/1.1 100"), "no interim response may precede the rejection");
+    assert_eq!(body, b"expectation failed");
+    assert_closed(&mut stream).await;
+  }
+
+  #[tokio::test]
+  async fn connection_is_reusable_within_the_idle_window_and_closed_after() {
+    let addr = start_server().await;
+    let mut stream = TcpStream::connect(addr).await.unwrap();
+    let request = b"GET /keepalive-idle?idle=200 HTTP/1.1\r\nHost: localhost\r\n\r\n";
+
+    stream.write_all(request).await.unwrap();
+    let (head, body) = read_response(&mut stream).await;
+    assert!(head.starts_with("HTTP/1.1 200"));
+    assert!(head.contains("Connection: keep-alive"));
+    assert_eq!(body, b"keep-alive body");
+
+    // A second request on the same connection within the window is served.
+    stream.write_all(request).await.unwrap();
+    let (head, _) = read_response(&mut stream).await;
+    assert!(head.starts_with("HTTP/1.1 200"));
+
+    // After the idle window the server closes the connection.
+    let mut rest = Vec::new();
+    stream.read_to_end(&mut rest).await.unwrap();
+    assert!(rest.is_empty());
+  }
+}
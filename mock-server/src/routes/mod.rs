@@ -0,0 +1,62 @@
+mod content;
+mod encoding;
+mod flow;
+mod wire;
+
+use crate::{write_response, Flow, MockServerOptions, Request, Stream};
+
+/// Dispatches the parsed request to its route handler.
+///
+/// Unknown paths get a plain 404 so tests fail loudly when they hit a typo'd route rather
+/// than silently exercising the wrong behavior.
+pub async fn handle<S: Stream>(
+  request: &Request,
+  stream: &mut S,
+  options: &MockServerOptions,
+) -> std::io::Result<Flow> {
+  match request.path() {
+    "/health" => {
+      write_response(stream, 200, "OK", &[], b"Ok").await?;
+      Ok(Flow::KeepAlive)
+    },
+    "/ambiguous-framing" => wire::ambiguous_framing(request, stream).await,
+    "/bad-json" => content::bad_json(request, stream).await,
+    "/bad-redirect" => content::bad_redirect(request, stream).await,
+    "/binary-text" => content::binary_text(request, stream).await,
+    "/captive" => content::captive(request, stream).await,
+    "/body-before-status" => wire::body_before_status(request, stream).await,
+    "/case-headers" => wire::case_headers(request, stream).await,
+    "/cdn" => content::cdn(request, stream).await,
+    "/chunk-ext" => wire::chunk_ext(request, stream).await,
+    "/consume-then-respond" => content::consume_then_respond(request, stream).await,
+    "/deflate" => encoding::deflate(request, stream).await,
+    "/double-response" => wire::double_response(request, stream).await,
+    "/exact" => content::exact(request, stream).await,
+    "/force-close" => flow::force_close(request, stream).await,
+    "/grow" => content::grow(request, stream).await,
+    "/gzip-undeclared" => encoding::gzip_undeclared(request, stream).await,
+    "/infinite" => wire::infinite(request, stream).await,
+    "/keepalive-idle" => flow::keepalive_idle(request, stream).await,
+    "/localized" => content::localized(request, stream).await,
+    "/long-reason" => wire::long_reason(request, stream).await,
+    "/many-cookies" => content::many_cookies(request, stream).await,
+    "/method-echo" => content::method_echo(request, stream).await,
+    "/nonce-response" => content::nonce_response(request, stream).await,
+    "/pipeline-marker" => flow::pipeline_marker(request, stream).await,
+    "/portal" => content::portal(request, stream).await,
+    "/ramp" => wire::ramp(request, stream).await,
+    "/raw-request" => content::raw_request(request, stream).await,
+    "/reject-upload" => flow::reject_upload(request, stream).await,
+    "/resource" => content::resource(request, stream).await,
+    "/segmented" => wire::segmented(request, stream).await,
+    "/signed-url" => content::signed_url(request, stream, options).await,
+    "/sni" => content::sni(request, stream).await,
+    "/stream-echo" => wire::stream_echo(request, stream).await,
+    "/warmup" => content::warmup(request, stream).await,
+    "/ws-headers" => wire::ws_headers(request, stream).await,
+    _ => {
+      write_response(stream, 404, "Not Found", &[], b"not found").await?;
+      Ok(Flow::KeepAlive)
+    },
+  }
+}
@@ -0,0 +1,568 @@
+//! Routes that take over the raw stream to control exactly how response bytes appear on the
+//! wire, including shapes a compliant HTTP library would refuse to produce.
+
+use std::time::Duration;
+
+use tokio::io::{AsyncReadExt, AsyncWriteExt};
+
+use crate::{Flow, Request, Stream};
+
+/// `/segmented?parts=N&delay=MS`: writes one complete, valid HTTP response split across `N`
+/// separate writes with a flush and a short delay between each, forcing the client to perform
+/// multiple reads. Clients that assume a single read per response will see a truncated
+/// response here.
+pub async fn segmented<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let parts: usize = request.query("parts").and_then(|v| v.parse().ok()).unwrap_or(2).max(1);
+  let delay_ms: u64 = request.query("delay").and_then(|v| v.parse().ok()).unwrap_or(10);
+
+  let body = "segmented response body: the quick brown fox jumps over the lazy dog";
+  let response = format!(
+    "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: {}\r\n\r\n{}",
+    body.len(),
+    body
+  );
+
+  let bytes = response.as_bytes();
+  let chunk_size = bytes.len().div_ceil(parts);
+  for part in bytes.chunks(chunk_size) {
+    stream.write_all(part).await?;
+    stream.flush().await?;
+    tokio::time::sleep(Duration::from_millis(delay_ms)).await;
+  }
+  Ok(Flow::Close)
+}
+
+/// `/body-before-status`: writes body bytes before a valid status line, violating HTTP
+/// framing. A well-behaved client must reject this; it reproduces pathological upstreams seen
+/// in fuzz-style robustness testing.
+pub async fn body_before_status<S: Stream>(
+  _request: &Request,
+  stream: &mut S,
+) -> std::io::Result<Flow> {
+  stream.write_all(b"this body arrives before any status line\r\n").await?;
+  stream.flush().await?;
+  stream.write_all(b"HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok").await?;
+  Ok(Flow::Close)
+}
+
+/// `/double-response`: writes two complete HTTP responses back to back for a single request.
+/// A correct client consumes only the first and must not attribute the second, unsolicited
+/// response to any request; this reproduces response-desync and request-smuggling-adjacent
+/// bugs.
+pub async fn double_response<S: Stream>(
+  _request: &Request,
+  stream: &mut S,
+) -> std::io::Result<Flow> {
+  stream.write_all(b"HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nfirst").await?;
+  stream.flush().await?;
+  stream.write_all(b"HTTP/1.1 200 OK\r\nContent-Length: 18\r\n\r\nunsolicited second").await?;
+  Ok(Flow::Close)
+}
+
+/// `/infinite?chunk=B&delay=MS`: streams `B`-byte chunks forever using chunked encoding and
+/// no `Content-Length`, for verifying that the prover enforces `max_recv_data` against a
+/// never-ending stream and closes at its cap. The loop ends when the client disconnects,
+/// which surfaces here as a write error.
+pub async fn infinite<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let chunk: usize = request.query("chunk").and_then(|v| v.parse().ok()).unwrap_or(1024).max(1);
+  let delay_ms: u64 = request.query("delay").and_then(|v| v.parse().ok()).unwrap_or(0);
+
+  stream
+    .write_all(
+      b"HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\nTransfer-Encoding: \
+        chunked\r\n\r\n",
+    )
+    .await?;
+
+  let payload = vec![b'x'; chunk];
+  loop {
+    stream.write_all(format!("{:x}\r\n", chunk).as_bytes()).await?;
+    stream.write_all(&payload).await?;
+    stream.write_all(b"\r\n").await?;
+    stream.flush().await?;
+    if delay_ms > 0 {
+      tokio::time::sleep(Duration::from_millis(delay_ms)).await;
+    }
+  }
+}
+
+/// `/chunk-ext`: writes a chunked body with a chunk extension (`<size>;ext=val`) on every
+/// chunk size line. Extensions are a valid but rarely-exercised part of HTTP/1.1 chunked
+/// encoding that strict parsers may mishandle; a correct parser ignores them and decodes the
+/// body normally.
+pub async fn chunk_ext<S: Stream>(_request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  stream
+    .write_all(b"HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n")
+    .await?;
+  for (i, chunk) in [&b"first chunk"[..], b"second chunk", b"third chunk"].iter().enumerate() {
+    stream.write_all(format!("{:x};ext=val{}\r\n", chunk.len(), i).as_bytes()).await?;
+    stream.write_all(chunk).await?;
+    stream.write_all(b"\r\n").await?;
+  }
+  stream.write_all(b"0;final=1\r\n\r\n").await?;
+  stream.flush().await?;
+  Ok(Flow::Close)
+}
+
+/// `/stream-echo`: requires a chunked request body and echoes every request chunk back
+/// immediately as a response chunk, before the request has finished — as close to full
+/// duplex as HTTP/1.1 allows. Clients that cannot read while still writing simply see the
+/// echoes buffered in the socket until they get around to reading.
+pub async fn stream_echo<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  if !request.chunked() {
+    let response =
+      "HTTP/1.1 400 Bad Request\r\nContent-Length: 29\r\n\r\nchunked request body required";
+    stream.write_all(response.as_bytes()).await?;
+    return Ok(Flow::Close);
+  }
+
+  stream
+    .write_all(
+      b"HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\nTransfer-Encoding: \
+        chunked\r\n\r\n",
+    )
+    .await?;
+  stream.flush().await?;
+
+  let mut pending = request.pending.clone();
+  loop {
+    let chunk = read_request_chunk(stream, &mut pending).await?;
+    if chunk.is_empty() {
+      break;
+    }
+    stream.write_all(format!("{:x}\r\n", chunk.len()).as_bytes()).await?;
+    stream.write_all(&chunk).await?;
+    stream.write_all(b"\r\n").await?;
+    stream.flush().await?;
+  }
+  stream.write_all(b"0\r\n\r\n").await?;
+  Ok(Flow::Close)
+}
+
+/// Reads one chunk of a chunked request body, pulling more bytes from the stream as needed.
+/// Returns an empty chunk for the terminator. Chunk extensions are ignored; trailers are not
+/// supported.
+async fn read_request_chunk<S: Stream>(
+  stream: &mut S,
+  pending: &mut Vec<u8>,
+) -> std::io::Result<Vec<u8>> {
+  let line_end = loop {
+    if let Some(pos) = pending.windows(2).position(|w| w == b"\r\n") {
+      break pos;
+    }
+    fill(stream, pending).await?;
+  };
+  let size_line = String::from_utf8_lossy(&pending[..line_end]).to_string();
+  let size =
+    usize::from_str_radix(size_line.split(';').next().unwrap_or("").trim(), 16).map_err(|_| {
+      std::io::Error::new(std::io::ErrorKind::InvalidData, "malformed chunk size line")
+    })?;
+  pending.drain(..line_end + 2);
+  while pending.len() < size + 2 {
+    fill(stream, pending).await?;
+  }
+  let chunk = pending[..size].to_vec();
+  pending.drain(..size + 2);
+  Ok(chunk)
+}
+
+/// Appends at least one fresh byte from the stream, erroring on EOF mid-body.
+async fn fill<S: Stream>(stream: &mut S, pending: &mut Vec<u8>) -> std::io::Result<()> {
+  let mut chunk = [0u8; 4096];
+  let n = stream.read(&mut chunk).await?;
+  if n == 0 {
+    return Err(std::io::Error::new(
+      std::io::ErrorKind::UnexpectedEof,
+      "connection closed mid-chunked-body",
+    ));
+  }
+  pending.extend_from_slice(&chunk[..n]);
+  Ok(())
+}
+
+/// `/long-reason?size=N`: writes a response whose status line carries an `N`-byte reason
+/// phrase, exercising parser bounds on a field that is rarely longer than "OK" in the wild.
+/// The rest of the response is well-formed, so a client with sane reason-phrase handling
+/// still parses the 200.
+pub async fn long_reason<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let size: usize =
+    request.query("size").and_then(|v| v.parse().ok()).unwrap_or(4096).min(1024 * 1024);
+  let body = "long reason phrase";
+  let response = format!(
+    "HTTP/1.1 200 {}\r\nContent-Type: text/plain\r\nContent-Length: {}\r\n\r\n{}",
+    "R".repeat(size),
+    body.len(),
+    body
+  );
+  stream.write_all(response.as_bytes()).await?;
+  Ok(Flow::Close)
+}
+
+/// `/case-headers`: writes a valid response whose header names use inconsistent casing
+/// (`content-TYPE`, `X-foo-BAR`, ...), as real servers do. The prover must match these
+/// case-insensitively while recording the original casing verbatim in the transcript, so the
+/// exact on-wire bytes matter and the response is written raw.
+pub async fn case_headers<S: Stream>(_request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let body = "mixed-case headers";
+  let response = format!(
+    "HTTP/1.1 200 OK\r\ncontent-TYPE: text/plain\r\nX-foo-BAR: baz\r\nconTENT-length: {}\r\n\r\n{}",
+    body.len(),
+    body
+  );
+  stream.write_all(response.as_bytes()).await?;
+  Ok(Flow::Close)
+}
+
+/// `/ramp?size=B&start_delay=MS&accel=F`: writes a `size`-byte body in fixed 256-byte
+/// chunks with a growing pause before each one — the first waits `start_delay`
+/// milliseconds and every later pause is the previous one times `accel`. Unlike the
+/// constant drip of `/segmented`, the worsening delay models congestion, exercising
+/// adaptive timeouts that should tolerate a slow start but notice a link that keeps
+/// degrading.
+pub async fn ramp<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let size: usize = request.query("size").and_then(|v| v.parse().ok()).unwrap_or(4096).min(1 << 20);
+  let start_delay: u64 = request.query("start_delay").and_then(|v| v.parse().ok()).unwrap_or(5);
+  let accel =
+    request.query("accel").and_then(|v| v.parse::<f64>().ok()).unwrap_or(1.0).clamp(0.1, 10.0);
+
+  let head = format!(
+    "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\nContent-Length: {}\r\n\r\n",
+    size
+  );
+  stream.write_all(head.as_bytes()).await?;
+
+  let body: Vec<u8> = (0..size).map(|i| (i % 256) as u8).collect();
+  let mut delay_ms = start_delay as f64;
+  for chunk in body.chunks(256) {
+    tokio::time::sleep(Duration::from_millis(delay_ms as u64)).await;
+    stream.write_all(chunk).await?;
+    stream.flush().await?;
+    // Capped so an aggressive accel cannot push a single pause past ten seconds.
+    delay_ms = (delay_ms * accel).min(10_000.0);
+  }
+  Ok(Flow::KeepAlive)
+}
+
+/// `/ambiguous-framing`: emits both `Transfer-Encoding: chunked` and `Content-Length` on
+/// one response — the framing ambiguity behind request smuggling, which RFC 9112 forbids
+/// and a strict client must reject. The body is genuinely chunked while the Content-Length
+/// counts the decoded bytes, so whichever header a lenient parser prefers changes where it
+/// believes the message ends.
+pub async fn ambiguous_framing<S: Stream>(
+  _request: &Request,
+  stream: &mut S,
+) -> std::io::Result<Flow> {
+  let body = "ambiguously framed body";
+  let response = format!(
+    "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\nContent-Length: \
+     {}\r\n\r\n{:x}\r\n{}\r\n0\r\n\r\n",
+    body.len(),
+    body.len(),
+    body
+  );
+  stream.write_all(response.as_bytes()).await?;
+  Ok(Flow::Close)
+}
+
+/// `/ws-headers?lead=N&trail=N&tabs=1`: writes a valid response whose header values are
+/// padded with `N` leading and trailing spaces (tabs when `tabs=1`). Optional whitespace
+/// around field values is legal and must be trimmed by the parser, while the transcript
+/// keeps the padded bytes verbatim — so the exact on-wire bytes matter and the response is
+/// written raw.
+pub async fn ws_headers<S: Stream>(request: &Request, stream: &mut S) -> std::io::Result<Flow> {
+  let lead: usize = request.query("lead").and_then(|v| v.parse().ok()).unwrap_or(4).min(1024);
+  let trail: usize = request.query("trail").and_then(|v| v.parse().ok()).unwrap_or(4).min(1024);
+  let pad = if request.query("tabs") == Some("1") { "\t" } else { " " };
+
+  let body = "whitespace padded headers";
+  // Built header by header: a single literal long enough to need reflowing gets its `\r\n`
+  // escapes split by rustfmt's string formatting, which mangles the wire bytes.
+  let mut response = String::from("HTTP/1.1 200 OK\r\n");
+  for (name, value) in [
+    ("X-Padded", "padded-value".to_string()),
+    ("Content-Type", "text/plain".to_string()),
+    ("Content-Length", body.len().to_string()),
+  ] {
+    response.push_str(&format!("{}:{}{}{}\r\n", name, pad.repeat(lead), value, pad.repeat(trail)));
+  }
+  response.push_str("\r\n");
+  response.push_str(body);
+  stream.write_all(response.as_bytes()).await?;
+  Ok(Flow::Close)
+}
+
+#[cfg(test)]
+mod tests {
+  use tokio::{
+    io::{AsyncReadExt, AsyncWriteExt},
+    net::TcpStream,
+  };
+
+  use crate::test_utils::start_server;
+
+  #[tokio::test]
+  async fn segmented_response_is_complete_despite_multiple_writes() {
+    let addr = start_server().await;
+    let mut stream = TcpStream::connect(addr).await.unwrap();
+    stream
+      .write_all(b"GET /segmented?parts=5&delay=5 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+      .await
+      .unwrap();
+
+    let mut response = Vec::new();
+    stream.read_to_end(&mut response).await.unwrap();
+    let text = String::from_utf8(response).unwrap();
+
+    assert!(text.starts_with("HTTP/1.1 200 OK\r\n"), "unexpected response: {}", text);
+    assert!(text.ends_with("the quick brown fox jumps over the lazy dog"));
+    let (head, body) = text.split_once("\r\n\r\n").unwrap();
+    assert!(head.contains(&format!("Content-Length: {}", body.len())));
+  }
+
+  #[tokio::test]
+  async fn large_response_arrives_intact_despite_tiny_write_segments() {
+    let addr = crate::test_utils::start_server_with_options(crate::MockServerOptions {
+      write_segment_bytes: Some(7),
+      ..Default::default()
+    })
+    .await;
+
+    // 32 KiB body: with 7-byte segments that is several thousand writes to reassemble.
+    let (head, body) = crate::test_utils::roundtrip(
+      addr,
+      b"GET /grow?start=32768&step=0&key=tiny-segments HTTP/1.1\r\nHost: localhost\r\n\r\n",
+    )
+    .await;
+    assert!(head.starts_with("HTTP/1.1 200"));
+    assert_eq!(body.len(), 32768);
+    let expected: Vec<u8> = (0..body.len()).map(|i| (i % 256) as u8).collect();
+    assert_eq!(body, expected);
+  }
+
+  #[tokio::test]
+  async fn stream_echo_returns_each_chunk_before_the_request_ends() {
+    let addr = start_server().await;
+    let mut stream = TcpStream::connect(addr).await.unwrap();
+    stream
+      .write_all(
+        b"POST /stream-echo HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n",
+      )
+      .await
+      .unwrap();
+
+    // Read the response head before sending any body: the route commits to chunked streaming
+    // up front.
+    let mut head = Vec::new();
+    while !head.ends_with(b"\r\n\r\n") {
+      let mut byte = [0u8; 1];
+      stream.read_exact(&mut byte).await.unwrap();
+      head.extend_from_slice(&byte);
+    }
+    assert!(head.starts_with(b"HTTP/1.1 200"));
+
+    // Each request chunk comes back as a response chunk while the request is still open.
+    for payload in [&b"first"[..], b"second chunk"] {
+      stream.write_all(format!("{:x}\r\n", payload.len()).as_bytes()).await.unwrap();
+      stream.write_all(payload).await.unwrap();
+      stream.write_all(b"\r\n").await.unwrap();
+
+      let expected = format!("{:x}\r\n{}\r\n", payload.len(), String::from_utf8_lossy(payload));
+      let mut echoed = vec![0u8; expected.len()];
+      stream.read_exact(&mut echoed).await.unwrap();
+      assert_eq!(echoed, expected.as_bytes());
+    }
+
+    stream.write_all(b"0\r\n\r\n").await.unwrap();
+    let mut rest = Vec::new();
+    stream.read_to_end(&mut rest).await.unwrap();
+    assert_eq!(rest, b"0\r\n\r\n");
+  }
+
+  #[tokio::test]
+  async fn long_reason_phrase_is_on_the_wire_and_the_response_still_parses() {
+    let addr = start_server().await;
+    let mut stream = TcpStream::connect(addr).await.unwrap();
+    stream
+      .write_all(b"GET /long-reason?size=9000 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+      .await
+      .unwrap();
+
+    let mut response = Vec::new();
+    stream.read_to_end(&mut response).await.unwrap();
+    let text = String::from_utf8(response).unwrap();
+
+    let status_line = text.lines().next().unwrap();
+    assert!(status_line.starts_with("HTTP/1.1 200 "));
+    assert_eq!(status_line.len(), "HTTP/1.1 200 ".len() + 9000);
+    assert!(text.ends_with("long reason phrase"));
+  }
+
+  #[tokio::test]
+  async fn ramp_transfer_time_reflects_the_accelerating_delays() {
+    let addr = start_server().await;
+    let mut stream = TcpStream::connect(addr).await.unwrap();
+
+    // Four 256-byte chunks with delays 20, 40, 80, and 160ms: at least 300ms in total,
+    // where a constant drip at the starting delay would take only 80ms.
+    let start = std::time::Instant::now();
+    stream
+      .write_all(b"GET /ramp?size=1024&start_delay=20&accel=2 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+      .await
+      .unwrap();
+    let (head, body) = crate::test_utils::read_response(&mut stream).await;
+
+    assert!(head.starts_with("HTTP/1.1 200"));
+    assert_eq!(body.len(), 1024);
+    let expected: Vec<u8> = (0..1024).map(|i| (i % 256) as u8).collect();
+    assert_eq!(body, expected);
+    assert!(start.elapsed() >= std::time::Duration::from_millis(300));
+  }
+
+  #[tokio::test]
+  async fn ambiguous_framing_carries_both_length_headers_on_the_wire() {
+    let addr = start_server().await;
+    let mut stream = TcpStream::connect(addr).await.unwrap();
+    stream.write_all(b"GET /ambiguous-framing HTTP/1.1\r\nHost: localhost\r\n\r\n").await.unwrap();
+
+    let mut response = Vec::new();
+    stream.read_to_end(&mut response).await.unwrap();
+    let text = String::from_utf8(response).unwrap();
+
+    let (head, body) = text.split_once("\r\n\r\n").unwrap();
+    assert!(head.starts_with("HTTP/1.1 200"));
+    assert!(head.contains("Transfer-Encoding: chunked\r\n"));
+    // The blank line splits off the head's final CRLF, so the last header ends the string.
+    assert!(head.ends_with("Content-Length: 23"), "head: {:?}", head);
+    // The body really is chunked, so a TE-preferring parser and a CL-preferring parser
+    // disagree about where the message ends.
+    assert_eq!(body, "17\r\nambiguously framed body\r\n0\r\n\r\n");
+  }
+
+  #[tokio::test]
+  async fn ws_headers_padding_is_on_the_wire_and_trims_to_the_real_value() {
+    let addr = start_server().await;
+    let mut stream = TcpStream::connect(addr).await.unwrap();
+    stream
+      .write_all(b"GET /ws-headers?lead=3&trail=2&tabs=1 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+      .await
+      .unwrap();
+
+    let mut response = Vec::new();
+    stream.read_to_end(&mut response).await.unwrap();
+    let text = String::from_utf8(response).unwrap();
+
+    // The padding must survive verbatim on the wire for transcript fidelity.
+    assert!(text.contains("X-Padded:\t\t\tpadded-value\t\t\r\n"), "unexpected response: {}", text);
+    assert!(text.contains("\r\nContent-Length:\t\t\t"), "unexpected response: {}", text);
+
+    // A conforming parser trims optional whitespace and recovers the field value.
+    let (head, body) = text.split_once("\r\n\r\n").unwrap();
+    let padded = head.lines().find_map(|line| line.strip_prefix("X-Padded:")).unwrap();
+    assert_eq!(padded.trim(), "padded-value");
+    assert_eq!(body, "whitespace padded headers");
+  }
+
+  #[tokio::test]
+  async fn infinite_streams_chunked_data_until_the_client_disconnects() {
+    let addr = start_server().await;
+    let mut stream = TcpStream::connect(addr).await.unwrap();
+    stream.write_all(b"GET /infinite?chunk=512 HTTP/1.1\r\nHost: localhost\r\n\r\n").await.unwrap();
+
+    // Read well past a few chunks' worth, then disconnect mid-stream as a capped prover
+    // would; the server's next write fails and ends its loop.
+    let cap = 16 * 1024;
+    let mut received = Vec::new();
+    while received.len() < cap {
+      let mut chunk = [0u8; 4096];
+      let n = stream.read(&mut chunk).await.unwrap();
+      assert!(n > 0, "stream ended before the cap was reached");
+      received.extend_from_slice(&chunk[..n]);
+    }
+    drop(stream);
+
+    let text = String::from_utf8_lossy(&received);
+    assert!(text.starts_with("HTTP/1.1 200 OK\r\n"));
+    assert!(text.contains("Transfer-Encoding: chunked"));
+    assert!(!text.contains("Content-Length"));
+    assert!(text.contains("\r\n200\r\n"), "chunk size lines must be on the wire");
+  }
+
+  #[tokio::test]
+  async fn chunk_ext_puts_extensions_on_the_wire_and_the_body_still_decodes() {
+    let addr = start_server().await;
+    let mut stream = TcpStream::connect(addr).await.unwrap();
+    stream.write_all(b"GET /chunk-ext HTTP/1.1\r\nHost: localhost\r\n\r\n").await.unwrap();
+
+    let mut response = Vec::new();
+    stream.read_to_end(&mut response).await.unwrap();
+    let text = String::from_utf8(response).unwrap();
+
+    assert!(text.contains(";ext=val0\r\n"), "response: {}", text);
+    assert!(text.contains(";ext=val1\r\n"));
+    assert!(text.contains("\r\n0;final=1\r\n\r\n"));
+
+    // Decode the chunked body, ignoring extensions as a correct parser would.
+    let (_, mut rest) = text.split_once("\r\n\r\n").unwrap();
+    let mut body = String::new();
+    loop {
+      let (size_line, after) = rest.split_once("\r\n").unwrap();
+      let size_hex = size_line.split(';').next().unwrap();
+      let size = usize::from_str_radix(size_hex, 16).unwrap();
+      if size == 0 {
+        break;
+      }
+      body.push_str(&after[..size]);
+      rest = &after[size + 2..];
+    }
+    assert_eq!(body, "first chunksecond chunkthird chunk");
+  }
+
+  #[tokio::test]
+  async fn case_headers_preserves_exact_on_wire_casing() {
+    let addr = start_server().await;
+    let mut stream = TcpStream::connect(addr).await.unwrap();
+    stream.write_all(b"GET /case-headers HTTP/1.1\r\nHost: localhost\r\n\r\n").await.unwrap();
+
+    let mut response = Vec::new();
+    stream.read_to_end(&mut response).await.unwrap();
+    let text = String::from_utf8(response).unwrap();
+
+    // Exact casing, not just case-insensitive presence: the transcript must record these
+    // bytes verbatim.
+    assert!(text.contains("\r\ncontent-TYPE: text/plain\r\n"), "response: {}", text);
+    assert!(text.contains("\r\nX-foo-BAR: baz\r\n"));
+    assert!(text.contains("\r\nconTENT-length: 18\r\n"));
+    assert!(!text.contains("Content-Type:"));
+    assert!(text.ends_with("mixed-case headers"));
+  }
+
+  #[tokio::test]
+  async fn double_response_puts_both_responses_on_the_wire() {
+    let addr = start_server().await;
+    let mut stream = TcpStream::connect(addr).await.unwrap();
+    stream.write_all(b"GET /double-response HTTP/1.1\r\nHost: localhost\r\n\r\n").await.unwrap();
+
+    let mut response = Vec::new();
+    stream.read_to_end(&mut response).await.unwrap();
+    let text = String::from_utf8(response).unwrap();
+
+    assert_eq!(text.matches("HTTP/1.1 200 OK").count(), 2, "response: {}", text);
+    assert!(text.contains("\r\n\r\nfirstHTTP/1.1"), "second response must follow immediately");
+    assert!(text.ends_with("unsolicited second"));
+  }
+
+  #[tokio::test]
+  async fn body_before_status_puts_out_of_order_framing_on_the_wire() {
+    let addr = start_server().await;
+    let mut stream = TcpStream::connect(addr).await.unwrap();
+    stream.write_all(b"GET /body-before-status HTTP/1.1\r\nHost: localhost\r\n\r\n").await.unwrap();
+
+    let mut response = Vec::new();
+    stream.read_to_end(&mut response).await.unwrap();
+    let text = String::from_utf8(response).unwrap();
+
+    assert!(text.starts_with("this body arrives before any status line"));
+    assert!(text.contains("HTTP/1.1 200 OK"));
+    assert!(!text.starts_with("HTTP/1.1"));
+  }
+}
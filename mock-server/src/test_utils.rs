@@ -0,0 +1,150 @@
+use std::{net::SocketAddr, sync::Arc};
+
+use tokio::{
+  io::{AsyncReadExt, AsyncWriteExt},
+  net::TcpStream,
+};
+
+use crate::{MockServer, MockServerOptions, Stream};
+
+/// Binds a [`MockServer`] to an ephemeral port, runs it in the background, and returns its
+/// address for tests to connect to.
+pub async fn start_server() -> SocketAddr {
+  start_server_with_options(MockServerOptions::default()).await
+}
+
+/// Like [`start_server`], but with explicit server options.
+pub async fn start_server_with_options(options: MockServerOptions) -> SocketAddr {
+  let server = MockServer::bind_with_options("127.0.0.1:0", options).await.unwrap();
+  let addr = server.local_addr().unwrap();
+  tokio::spawn(server.run());
+  addr
+}
+
+/// Like [`start_server_with_options`], but terminating TLS with the repo's fixture
+/// certificate.
+pub async fn start_tls_server() -> SocketAddr {
+  start_tls_server_with_options(MockServerOptions::default()).await
+}
+
+/// Like [`start_tls_server`], but with explicit server options.
+pub async fn start_tls_server_with_options(options: MockServerOptions) -> SocketAddr {
+  let server = MockServer::bind_tls(
+    "127.0.0.1:0",
+    "../fixture/certs/server-cert.pem",
+    "../fixture/certs/server-key.pem",
+    options,
+  )
+  .await
+  .unwrap();
+  let addr = server.local_addr().unwrap();
+  tokio::spawn(server.run());
+  addr
+}
+
+/// Sends a raw request on a fresh connection and reads exactly one well-framed response,
+/// returning the head (status line and headers) and body separately.
+pub async fn roundtrip(addr: SocketAddr, raw_request: &[u8]) -> (String, Vec<u8>) {
+  let mut stream = TcpStream::connect(addr).await.unwrap();
+  stream.write_all(raw_request).await.unwrap();
+  read_response(&mut stream).await
+}
+
+/// Like [`roundtrip`], but over TLS with the given SNI. The server certificate is not
+/// verified — tests care about what the server observed, not about trust.
+pub async fn tls_roundtrip(addr: SocketAddr, sni: &str, raw_request: &[u8]) -> (String, Vec<u8>) {
+  let config = rustls::ClientConfig::builder()
+    .dangerous()
+    .with_custom_certificate_verifier(Arc::new(AcceptAnyCert))
+    .with_no_client_auth();
+  let connector = tokio_rustls::TlsConnector::from(Arc::new(config));
+  let server_name = rustls::pki_types::ServerName::try_from(sni.to_string()).unwrap();
+
+  let tcp = TcpStream::connect(addr).await.unwrap();
+  let mut stream = connector.connect(server_name, tcp).await.unwrap();
+  stream.write_all(raw_request).await.unwrap();
+  read_response(&mut stream).await
+}
+
+/// Certificate verifier that accepts anything, for test clients talking to the fixture
+/// certificate. Never use outside tests.
+#[derive(Debug)]
+struct AcceptAnyCert;
+
+impl rustls::client::danger::ServerCertVerifier for AcceptAnyCert {
+  fn verify_server_cert(
+    &self,
+    _end_entity: &rustls::pki_types::CertificateDer,
+    _intermediates: &[rustls::pki_types::CertificateDer],
+    _server_name: &rustls::pki_types::ServerName,
+    _ocsp_response: &[u8],
+    _now: rustls::pki_types::UnixTime,
+  ) -> Result<rustls::client::danger::ServerCertVerified, rustls::Error> {
+    Ok(rustls::client::danger::ServerCertVerified::assertion())
+  }
+
+  fn verify_tls12_signature(
+    &self,
+    _message: &[u8],
+    _cert: &rustls::pki_types::CertificateDer,
+    _dss: &rustls::DigitallySignedStruct,
+  ) -> Result<rustls::client::danger::HandshakeSignatureValid, rustls::Error> {
+    Ok(rustls::client::danger::HandshakeSignatureValid::assertion())
+  }
+
+  fn verify_tls13_signature(
+    &self,
+    _message: &[u8],
+    _cert: &rustls::pki_types::CertificateDer,
+    _dss: &rustls::DigitallySignedStruct,
+  ) -> Result<rustls::client::danger::HandshakeSignatureValid, rustls::Error> {
+    Ok(rustls::client::danger::HandshakeSignatureValid::assertion())
+  }
+
+  fn supported_verify_schemes(&self) -> Vec<rustls::SignatureScheme> {
+    rustls::crypto::ring::default_provider().signature_verification_algorithms.supported_schemes()
+  }
+}
+
+/// Asserts the server has closed `stream`: a further read yields EOF (or a reset), never
+/// data. Companion to routes like `/force-close` for verifying the client-visible side of a
+/// server-initiated close — a connection this has passed for must not be reused.
+pub async fn assert_closed<S: Stream>(stream: &mut S) {
+  let mut rest = Vec::new();
+  match stream.read_to_end(&mut rest).await {
+    Ok(_) => assert!(rest.is_empty(), "server sent unexpected bytes instead of closing"),
+    // A reset also proves the connection is gone.
+    Err(_) => {},
+  }
+}
+
+/// Reads one `Content-Length`-framed response from the stream.
+pub async fn read_response<S: Stream>(stream: &mut S) -> (String, Vec<u8>) {
+  let mut buf = Vec::new();
+  let head_end = loop {
+    if let Some(pos) = buf.windows(4).position(|w| w == b"\r\n\r\n") {
+      break pos + 4;
+    }
+    let mut chunk = [0u8; 4096];
+    let n = stream.read(&mut chunk).await.unwrap();
+    assert!(n > 0, "connection closed before response head was complete");
+    buf.extend_from_slice(&chunk[..n]);
+  };
+
+  let head = String::from_utf8_lossy(&buf[..head_end]).to_string();
+  let content_length = head
+    .lines()
+    .find_map(|line| {
+      let (name, value) = line.split_once(':')?;
+      name.eq_ignore_ascii_case("content-length").then(|| value.trim().parse::<usize>().unwrap())
+    })
+    .unwrap_or(0);
+
+  while buf.len() < head_end + content_length {
+    let mut chunk = [0u8; 4096];
+    let n = stream.read(&mut chunk).await.unwrap();
+    assert!(n > 0, "connection closed before response body was complete");
+    buf.extend_from_slice(&chunk[..n]);
+  }
+  (head, buf[head_end..head_end + content_length].to_vec())
+}
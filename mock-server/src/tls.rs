@@ -0,0 +1,114 @@
+//! TLS termination for the mock server, so routes can observe handshake parameters such as
+//! the SNI the client presented.
+
+use std::{
+  fs,
+  future::Future,
+  io,
+  pin::Pin,
+  sync::Arc,
+  task::{ready, Context, Poll},
+  time::Duration,
+};
+
+use rustls::pki_types::{CertificateDer, PrivateKeyDer};
+use tokio::{
+  io::{AsyncRead, AsyncWrite, ReadBuf},
+  time::Sleep,
+};
+use tokio_rustls::TlsAcceptor;
+
+/// Builds a [`TlsAcceptor`] from a PEM certificate chain and private key on disk.
+pub(crate) fn acceptor(cert_path: &str, key_path: &str) -> io::Result<TlsAcceptor> {
+  let config = rustls::ServerConfig::builder()
+    .with_no_client_auth()
+    .with_single_cert(load_certs(cert_path)?, load_private_key(key_path)?)
+    .map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e))?;
+  Ok(TlsAcceptor::from(Arc::new(config)))
+}
+
+fn load_certs(filename: &str) -> io::Result<Vec<CertificateDer<'static>>> {
+  let certfile = fs::File::open(filename)
+    .map_err(|e| io::Error::new(e.kind(), format!("failed to open {}: {}", filename, e)))?;
+  rustls_pemfile::certs(&mut io::BufReader::new(certfile)).collect()
+}
+
+/// Wraps a connection so its first write is held back by a configurable delay. Placed under
+/// the TLS acceptor, the held-back write is the server's first handshake flight (ServerHello
+/// onward), which lets clients exercise handshake-phase timeouts in isolation from
+/// application-phase ones. With no delay configured the wrapper is a passthrough.
+pub(crate) struct DelayedHandshake<S> {
+  inner: S,
+  delay: Option<Pin<Box<Sleep>>>,
+}
+
+impl<S> DelayedHandshake<S> {
+  pub(crate) fn new(inner: S, delay: Option<Duration>) -> Self {
+    Self { inner, delay: delay.map(|d| Box::pin(tokio::time::sleep(d))) }
+  }
+}
+
+impl<S: AsyncRead + Unpin> AsyncRead for DelayedHandshake<S> {
+  fn poll_read(
+    self: Pin<&mut Self>,
+    cx: &mut Context<'_>,
+    buf: &mut ReadBuf<'_>,
+  ) -> Poll<io::Result<()>> {
+    Pin::new(&mut self.get_mut().inner).poll_read(cx, buf)
+  }
+}
+
+impl<S: AsyncWrite + Unpin> AsyncWrite for DelayedHandshake<S> {
+  fn poll_write(self: Pin<&mut Self>, cx: &mut Context<'_>, buf: &[u8]) -> Poll<io::Result<usize>> {
+    let this = self.get_mut();
+    if let Some(sleep) = &mut this.delay {
+      ready!(sleep.as_mut().poll(cx));
+      this.delay = None;
+    }
+    Pin::new(&mut this.inner).poll_write(cx, buf)
+  }
+
+  fn poll_flush(self: Pin<&mut Self>, cx: &mut Context<'_>) -> Poll<io::Result<()>> {
+    Pin::new(&mut self.get_mut().inner).poll_flush(cx)
+  }
+
+  fn poll_shutdown(self: Pin<&mut Self>, cx: &mut Context<'_>) -> Poll<io::Result<()>> {
+    Pin::new(&mut self.get_mut().inner).poll_shutdown(cx)
+  }
+}
+
+fn load_private_key(filename: &str) -> io::Result<PrivateKeyDer<'static>> {
+  let keyfile = fs::File::open(filename)
+    .map_err(|e| io::Error::new(e.kind(), format!("failed to open {}: {}", filename, e)))?;
+  rustls_pemfile::private_key(&mut io::BufReader::new(keyfile))?
+    .ok_or_else(|| io::Error::new(io::ErrorKind::InvalidData, "no private key found"))
+}
+
+#[cfg(test)]
+mod tests {
+  use std::time::{Duration, Instant};
+
+  use crate::{
+    test_utils::{start_tls_server_with_options, tls_roundtrip},
+    MockServerOptions,
+  };
+
+  #[tokio::test]
+  async fn handshake_completion_is_held_back_by_the_configured_delay() {
+    let delay = Duration::from_millis(300);
+    let addr = start_tls_server_with_options(MockServerOptions {
+      tls_handshake_delay: Some(delay),
+      ..Default::default()
+    })
+    .await;
+
+    let started = Instant::now();
+    let (head, _) =
+      tls_roundtrip(addr, "localhost", b"GET /health HTTP/1.1\r\nHost: localhost\r\n\r\n").await;
+
+    // The request only completes after the delayed handshake, so the total time bounds the
+    // handshake time from below.
+    assert!(started.elapsed() >= delay);
+    assert!(head.starts_with("HTTP/1.1 200"));
+  }
+}
@@ -0,0 +1,113 @@
+//! Append-only audit log for proxy connections, one JSON record per completed connection.
+//! This is evidence for proof auditing, kept distinct from operational logs.
+
+use std::{
+  fs::{File, OpenOptions},
+  io::Write,
+  net::IpAddr,
+  sync::Mutex,
+};
+
+use chrono::{DateTime, Utc};
+use serde::Serialize;
+use tracing::warn;
+
+/// Records are fsync'd every this many appends, bounding loss on crash without paying for a
+/// sync per connection.
+const SYNC_EVERY: u64 = 16;
+
+/// One completed proxy connection.
+#[derive(Debug, Serialize)]
+pub struct AuditRecord {
+  pub target:          String,
+  /// The IP actually dialed, from the connected socket's peer address.
+  pub target_ip:       Option<IpAddr>,
+  pub started_at:      DateTime<Utc>,
+  pub ended_at:        DateTime<Utc>,
+  pub bytes_to_target: u64,
+  pub bytes_to_client: u64,
+  /// WebSocket close code the proxy sent, if the proxy initiated the close.
+  pub close_code:      Option<u16>,
+}
+
+/// Serializes appends of [`AuditRecord`]s to a newline-delimited JSON file.
+pub struct AuditLog {
+  file: Mutex<(File, u64)>,
+}
+
+impl AuditLog {
+  pub fn open(path: &str) -> std::io::Result<Self> {
+    let file = OpenOptions::new().create(true).append(true).open(path)?;
+    Ok(Self { file: Mutex::new((file, 0)) })
+  }
+
+  /// Appends one record. Failures are logged rather than propagated: losing an audit line
+  /// must not tear down the connection handling around it.
+  pub fn append(&self, record: &AuditRecord) {
+    let line = match serde_json::to_string(record) {
+      Ok(line) => line,
+      Err(e) => {
+        warn!("failed to serialize audit record: {}", e);
+        return;
+      },
+    };
+    let mut guard = self.file.lock().unwrap();
+    let (file, appended) = &mut *guard;
+    if let Err(e) = writeln!(file, "{}", line) {
+      warn!("failed to append audit record: {}", e);
+      return;
+    }
+    *appended += 1;
+    if *appended % SYNC_EVERY == 0 {
+      if let Err(e) = file.sync_data() {
+        warn!("failed to sync audit file: {}", e);
+      }
+    }
+  }
+}
+
+#[cfg(test)]
+mod tests {
+  use chrono::Utc;
+  use uuid::Uuid;
+
+  use super::{AuditLog, AuditRecord};
+
+  fn record(target: &str, close_code: Option<u16>) -> AuditRecord {
+    AuditRecord {
+      target: target.to_string(),
+      target_ip: Some("192.0.2.7".parse().unwrap()),
+      started_at: Utc::now(),
+      ended_at: Utc::now(),
+      bytes_to_target: 123,
+      bytes_to_client: 4567,
+      close_code,
+    }
+  }
+
+  #[test]
+  fn each_connection_appends_one_well_formed_json_line() {
+    let path = std::env::temp_dir().join(format!("audit-{}.ndjson", Uuid::new_v4()));
+    let path = path.to_str().unwrap();
+    let log = AuditLog::open(path).unwrap();
+
+    log.append(&record("api.example.com:443", Some(1000)));
+    log.append(&record("other.example.com:443", None));
+
+    let contents = std::fs::read_to_string(path).unwrap();
+    let lines: Vec<&str> = contents.lines().collect();
+    assert_eq!(lines.len(), 2);
+
+    let first: serde_json::Value = serde_json::from_str(lines[0]).unwrap();
+    assert_eq!(first["target"], "api.example.com:443");
+    assert_eq!(first["target_ip"], "192.0.2.7");
+    assert_eq!(first["bytes_to_client"], 4567);
+    assert_eq!(first["close_code"], 1000);
+
+    let second: serde_json::Value = serde_json::from_str(lines[1]).unwrap();
+    assert_eq!(second["target"], "other.example.com:443");
+    assert_eq!(second["close_code"], serde_json::Value::Null);
+
+    std::fs::remove_file(path).unwrap();
+  }
+}
@@ -0,0 +1,158 @@
+//! External authorization for proxy targets: before dialing, the proxy asks a configured
+//! HTTP policy endpoint whether the connection should be allowed, so operators can
+//! centralize SSRF/abuse policy outside the binary.
+
+use std::{
+  collections::HashMap,
+  sync::Mutex,
+  time::{Duration, Instant},
+};
+
+use serde_json::json;
+use tracing::{debug, info};
+
+/// How long the policy endpoint is given to answer before the request is denied.
+const AUTHZ_TIMEOUT: Duration = Duration::from_secs(2);
+
+/// How long a decision is cached per target, keeping reconnect loops from hammering the
+/// policy endpoint while still picking up policy changes quickly.
+const AUTHZ_CACHE_TTL: Duration = Duration::from_secs(10);
+
+/// Client for an external allow/deny policy endpoint. The endpoint is POSTed a JSON document
+/// with the target, client IP, and origin, and anything other than a 200 response —
+/// including timeouts and transport errors — denies the connection (fail closed).
+pub struct AuthzClient {
+  url:    String,
+  client: reqwest::Client,
+  cache:  Mutex<HashMap<String, CachedDecision>>,
+}
+
+struct CachedDecision {
+  allowed:    bool,
+  expires_at: Instant,
+}
+
+impl AuthzClient {
+  pub fn new(url: String) -> Self {
+    let client = reqwest::Client::builder()
+      .timeout(AUTHZ_TIMEOUT)
+      .build()
+      .expect("reqwest client construction only fails on invalid builder options");
+    Self { url, client, cache: Mutex::new(HashMap::new()) }
+  }
+
+  /// Returns whether the connection to `target` is allowed, consulting the short-lived
+  /// per-target cache first.
+  pub async fn authorize(&self, target: &str, client_ip: &str, origin: &str) -> bool {
+    if let Some(decision) = self.cached(target) {
+      return decision;
+    }
+    let allowed = match self
+      .client
+      .post(&self.url)
+      .json(&json!({ "target": target, "client_ip": client_ip, "origin": origin }))
+      .send()
+      .await
+    {
+      Ok(response) => response.status() == reqwest::StatusCode::OK,
+      Err(e) => {
+        info!("authz endpoint unreachable, denying {}: {}", target, e);
+        false
+      },
+    };
+    self.cache.lock().unwrap().insert(target.to_string(), CachedDecision {
+      allowed,
+      expires_at: Instant::now() + AUTHZ_CACHE_TTL,
+    });
+    allowed
+  }
+
+  fn cached(&self, target: &str) -> Option<bool> {
+    let mut cache = self.cache.lock().unwrap();
+    match cache.get(target) {
+      Some(decision) if decision.expires_at > Instant::now() => {
+        debug!("authz cache hit for {}", target);
+        Some(decision.allowed)
+      },
+      Some(_) => {
+        cache.remove(target);
+        None
+      },
+      None => None,
+    }
+  }
+}
+
+#[cfg(test)]
+mod tests {
+  use std::sync::{
+    atomic::{AtomicUsize, Ordering},
+    Arc,
+  };
+
+  use tokio::{
+    io::{AsyncReadExt, AsyncWriteExt},
+    net::TcpListener,
+  };
+
+  use super::AuthzClient;
+
+  /// Starts a minimal policy endpoint answering every request with the given status line and
+  /// counting the connections it receives.
+  async fn policy_endpoint(status_line: &'static str) -> (String, Arc<AtomicUsize>) {
+    let listener = TcpListener::bind("127.0.0.1:0").await.unwrap();
+    let addr = listener.local_addr().unwrap();
+    let requests = Arc::new(AtomicUsize::new(0));
+    let counter = requests.clone();
+    tokio::spawn(async move {
+      loop {
+        let Ok((mut stream, _)) = listener.accept().await else { break };
+        counter.fetch_add(1, Ordering::SeqCst);
+        tokio::spawn(async move {
+          let mut buf = [0u8; 4096];
+          let _ = stream.read(&mut buf).await;
+          let response =
+            format!("{}\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", status_line);
+          let _ = stream.write_all(response.as_bytes()).await;
+        });
+      }
+    });
+    (format!("http://{}", addr), requests)
+  }
+
+  #[tokio::test]
+  async fn allows_on_200_and_denies_on_anything_else() {
+    let (allow_url, _) = policy_endpoint("HTTP/1.1 200 OK").await;
+    let authz = AuthzClient::new(allow_url);
+    assert!(authz.authorize("api.example.com:443", "198.51.100.7", "https://app").await);
+
+    let (deny_url, _) = policy_endpoint("HTTP/1.1 403 Forbidden").await;
+    let authz = AuthzClient::new(deny_url);
+    assert!(!authz.authorize("evil.example.com:443", "198.51.100.7", "https://app").await);
+  }
+
+  #[tokio::test]
+  async fn fails_closed_when_the_endpoint_is_unreachable() {
+    // Bind and drop a listener to get a port with nothing listening.
+    let listener = TcpListener::bind("127.0.0.1:0").await.unwrap();
+    let addr = listener.local_addr().unwrap();
+    drop(listener);
+
+    let authz = AuthzClient::new(format!("http://{}", addr));
+    assert!(!authz.authorize("api.example.com:443", "", "").await);
+  }
+
+  #[tokio::test]
+  async fn decisions_are_cached_per_target() {
+    let (url, requests) = policy_endpoint("HTTP/1.1 200 OK").await;
+    let authz = AuthzClient::new(url);
+
+    assert!(authz.authorize("api.example.com:443", "", "").await);
+    assert!(authz.authorize("api.example.com:443", "", "").await);
+    assert_eq!(requests.load(std::sync::atomic::Ordering::SeqCst), 1);
+
+    // A different target is a separate decision.
+    assert!(authz.authorize("other.example.com:443", "", "").await);
+    assert_eq!(requests.load(std::sync::atomic::Ordering::SeqCst), 2);
+  }
+}
@@ -44,6 +44,9 @@ pub enum NotaryServerError {
   #[error("Error occurred from reasing server config: {0}")]
   ServerConfigError(String),
 
+  #[error("Error occurred fetching attestation: {0}")]
+  AttestationError(String),
+
   #[error(transparent)]
   ProxyError(#[from] ProxyError),
 
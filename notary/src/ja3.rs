@@ -0,0 +1,274 @@
+//! Passive inspection of TLS ClientHello messages: JA3-style fingerprinting and ALPN
+//! extraction.
+//!
+//! The fingerprint identifies the client's TLS stack (relevant to notarization
+//! fingerprinting) from the first bytes it sends through the tunnel; the ALPN list feeds the
+//! proxy's protocol policy. Inspection is strictly passive: the bytes are parsed, never
+//! modified, and anything that is not a complete ClientHello is skipped.
+
+/// GREASE values (RFC 8701) are random placeholders and are excluded from fingerprints, as
+/// the JA3 definition requires.
+fn is_grease(value: u16) -> bool { value & 0xff == value >> 8 && value & 0x0f == 0x0a }
+
+/// Byte cursor over the ClientHello; every accessor returns `None` past the end, so a
+/// truncated message falls out of the parse instead of panicking.
+struct Cursor<'a> {
+  data: &'a [u8],
+  pos:  usize,
+}
+
+impl<'a> Cursor<'a> {
+  fn new(data: &'a [u8]) -> Self { Self { data, pos: 0 } }
+
+  fn remaining(&self) -> usize { self.data.len() - self.pos }
+
+  fn take(&mut self, n: usize) -> Option<&'a [u8]> {
+    let bytes = self.data.get(self.pos..self.pos + n)?;
+    self.pos += n;
+    Some(bytes)
+  }
+
+  fn u8(&mut self) -> Option<u8> { self.take(1).map(|b| b[0]) }
+
+  fn u16(&mut self) -> Option<u16> { self.take(2).map(|b| u16::from_be_bytes([b[0], b[1]])) }
+
+  fn u24(&mut self) -> Option<u32> {
+    self.take(3).map(|b| u32::from_be_bytes([0, b[0], b[1], b[2]]))
+  }
+}
+
+/// Parses `bytes` as one complete TLS ClientHello record and returns its JA3 string
+/// (`version,ciphers,extensions,curves,point_formats`, each list dash-separated). Returns
+/// `None` for non-TLS bytes, other handshake types, or a ClientHello fragmented across
+/// records.
+pub fn ja3_fingerprint(bytes: &[u8]) -> Option<String> {
+  let mut c = Cursor::new(bytes);
+  // TLS record header: handshake content type, record version, record length.
+  if c.u8()? != 0x16 {
+    return None;
+  }
+  c.take(2)?;
+  let record_len = c.u16()? as usize;
+  if c.remaining() < record_len {
+    // The ClientHello is fragmented across records (or still arriving); skip rather than
+    // guess.
+    return None;
+  }
+  // Handshake header: ClientHello type and length.
+  if c.u8()? != 0x01 {
+    return None;
+  }
+  c.u24()?;
+
+  let version = c.u16()?;
+  c.take(32)?;
+  let session_id_len = c.u8()? as usize;
+  c.take(session_id_len)?;
+
+  let cipher_bytes = c.u16()? as usize;
+  let mut ciphers = Vec::new();
+  for _ in 0..cipher_bytes / 2 {
+    let cipher = c.u16()?;
+    if !is_grease(cipher) {
+      ciphers.push(cipher);
+    }
+  }
+  let compression_len = c.u8()? as usize;
+  c.take(compression_len)?;
+
+  let mut extensions = Vec::new();
+  let mut curves = Vec::new();
+  let mut point_formats = Vec::new();
+  if c.remaining() >= 2 {
+    let extensions_len = c.u16()? as usize;
+    let end = c.pos + extensions_len;
+    while c.pos + 4 <= end {
+      let ext_type = c.u16()?;
+      let ext_len = c.u16()? as usize;
+      let ext_data = c.take(ext_len)?;
+      if is_grease(ext_type) {
+        continue;
+      }
+      extensions.push(ext_type);
+      match ext_type {
+        // supported_groups: u16 list length, then u16 curve ids.
+        0x000a => {
+          let mut ext = Cursor::new(ext_data);
+          let list_bytes = ext.u16()? as usize;
+          for _ in 0..list_bytes / 2 {
+            let curve = ext.u16()?;
+            if !is_grease(curve) {
+              curves.push(curve);
+            }
+          }
+        },
+        // ec_point_formats: u8 list length, then u8 format ids.
+        0x000b => {
+          let mut ext = Cursor::new(ext_data);
+          let list_bytes = ext.u8()? as usize;
+          for _ in 0..list_bytes {
+            point_formats.push(ext.u8()? as u16);
+          }
+        },
+        _ => {},
+      }
+    }
+  }
+
+  let join = |values: &[u16]| values.iter().map(|v| v.to_string()).collect::<Vec<_>>().join("-");
+  Some(format!(
+    "{},{},{},{},{}",
+    version,
+    join(&ciphers),
+    join(&extensions),
+    join(&curves),
+    join(&point_formats)
+  ))
+}
+
+/// Parses `bytes` as one complete TLS ClientHello record and returns the protocols offered
+/// in its ALPN extension, in offer order. Returns `Some(vec![])` for a ClientHello without
+/// ALPN, and `None` for anything that is not a complete ClientHello — callers enforcing an
+/// ALPN policy must treat both as "nothing to reject".
+pub fn alpn_protocols(bytes: &[u8]) -> Option<Vec<String>> {
+  let mut c = Cursor::new(bytes);
+  if c.u8()? != 0x16 {
+    return None;
+  }
+  c.take(2)?;
+  let record_len = c.u16()? as usize;
+  if c.remaining() < record_len {
+    return None;
+  }
+  if c.u8()? != 0x01 {
+    return None;
+  }
+  c.u24()?;
+
+  // Skip version, random, session id, cipher suites, and compression methods.
+  c.take(2)?;
+  c.take(32)?;
+  let session_id_len = c.u8()? as usize;
+  c.take(session_id_len)?;
+  let cipher_bytes = c.u16()? as usize;
+  c.take(cipher_bytes)?;
+  let compression_len = c.u8()? as usize;
+  c.take(compression_len)?;
+
+  let mut protocols = Vec::new();
+  if c.remaining() >= 2 {
+    let extensions_len = c.u16()? as usize;
+    let end = c.pos + extensions_len;
+    while c.pos + 4 <= end {
+      let ext_type = c.u16()?;
+      let ext_len = c.u16()? as usize;
+      let ext_data = c.take(ext_len)?;
+      // application_layer_protocol_negotiation: u16 list length, then length-prefixed names.
+      if ext_type == 0x0010 {
+        let mut ext = Cursor::new(ext_data);
+        let list_bytes = ext.u16()? as usize;
+        let list_end = ext.pos + list_bytes;
+        while ext.pos < list_end {
+          let name_len = ext.u8()? as usize;
+          let name = ext.take(name_len)?;
+          protocols.push(String::from_utf8_lossy(name).to_string());
+        }
+      }
+    }
+  }
+  Some(protocols)
+}
+
+#[cfg(test)]
+mod tests {
+  use super::{alpn_protocols, ja3_fingerprint};
+
+  /// Builds a minimal but structurally complete ClientHello with GREASE values sprinkled in
+  /// everywhere they can appear.
+  fn client_hello() -> Vec<u8> { client_hello_with_alpn(&[]) }
+
+  /// Like [`client_hello`], but additionally offering the given ALPN protocols.
+  fn client_hello_with_alpn(protocols: &[&str]) -> Vec<u8> {
+    let mut body = Vec::new();
+    body.extend_from_slice(&0x0303u16.to_be_bytes()); // client version: TLS 1.2 (771)
+    body.extend_from_slice(&[0u8; 32]); // random
+    body.push(0); // empty session id
+                  // Cipher suites: GREASE, TLS_AES_128_GCM_SHA256, TLS_AES_256_GCM_SHA384.
+    body.extend_from_slice(&6u16.to_be_bytes());
+    for cipher in [0x0a0au16, 0x1301, 0x1302] {
+      body.extend_from_slice(&cipher.to_be_bytes());
+    }
+    body.extend_from_slice(&[1, 0]); // null compression
+
+    let mut extensions = Vec::new();
+    for (ext_type, data) in [
+      (0x1a1au16, &[][..]),                          // GREASE extension
+      (0x0000, b"\x00\x08\x00\x00\x05hello"),        // server_name
+      (0x000a, b"\x00\x06\x2a\x2a\x00\x1d\x00\x17"), // groups: GREASE, x25519, secp256r1
+      (0x000b, b"\x01\x00"),                         // point formats: uncompressed
+    ] {
+      extensions.extend_from_slice(&ext_type.to_be_bytes());
+      extensions.extend_from_slice(&(data.len() as u16).to_be_bytes());
+      extensions.extend_from_slice(data);
+    }
+    if !protocols.is_empty() {
+      let mut list = Vec::new();
+      for protocol in protocols {
+        list.push(protocol.len() as u8);
+        list.extend_from_slice(protocol.as_bytes());
+      }
+      extensions.extend_from_slice(&0x0010u16.to_be_bytes());
+      extensions.extend_from_slice(&((list.len() + 2) as u16).to_be_bytes());
+      extensions.extend_from_slice(&(list.len() as u16).to_be_bytes());
+      extensions.extend_from_slice(&list);
+    }
+    body.extend_from_slice(&(extensions.len() as u16).to_be_bytes());
+    body.extend_from_slice(&extensions);
+
+    let mut handshake = vec![0x01];
+    handshake.extend_from_slice(&(body.len() as u32).to_be_bytes()[1..]);
+    handshake.extend_from_slice(&body);
+
+    let mut record = vec![0x16, 0x03, 0x01];
+    record.extend_from_slice(&(handshake.len() as u16).to_be_bytes());
+    record.extend_from_slice(&handshake);
+    record
+  }
+
+  #[test]
+  fn known_client_hello_yields_the_expected_fingerprint() {
+    let fingerprint = ja3_fingerprint(&client_hello()).unwrap();
+    // GREASE ciphers, extensions, and curves are all excluded.
+    assert_eq!(fingerprint, "771,4865-4866,0-10-11,29-23,0");
+  }
+
+  #[test]
+  fn non_tls_bytes_are_skipped() {
+    assert_eq!(ja3_fingerprint(b"GET / HTTP/1.1\r\n\r\n"), None);
+    assert_eq!(ja3_fingerprint(&[]), None);
+  }
+
+  #[test]
+  fn a_fragmented_client_hello_is_skipped() {
+    let hello = client_hello();
+    assert_eq!(ja3_fingerprint(&hello[..hello.len() - 10]), None);
+  }
+
+  #[test]
+  fn alpn_protocols_are_extracted_in_offer_order() {
+    let hello = client_hello_with_alpn(&["h2", "http/1.1"]);
+    assert_eq!(alpn_protocols(&hello), Some(vec!["h2".to_string(), "http/1.1".to_string()]));
+  }
+
+  #[test]
+  fn a_client_hello_without_alpn_yields_an_empty_list() {
+    assert_eq!(alpn_protocols(&client_hello()), Some(Vec::new()));
+  }
+
+  #[test]
+  fn alpn_extraction_skips_non_client_hello_bytes() {
+    assert_eq!(alpn_protocols(b"GET / HTTP/1.1\r\n\r\n"), None);
+    let hello = client_hello_with_alpn(&["h2"]);
+    assert_eq!(alpn_protocols(&hello[..hello.len() - 5]), None);
+  }
+}
@@ -28,13 +28,24 @@ use tower_service::Service;
 use tracing::{error, info};
 use tracing_subscriber::{layer::SubscriberExt, util::SubscriberInitExt};
 
+mod audit;
+mod authz;
 mod config;
 mod error;
+mod ja3;
 mod proxy;
+mod quota;
+mod ssrf;
+mod tee;
+#[cfg(test)] mod testdns;
+mod tls;
+mod upstream_tls;
 mod verifier;
+mod websocket_proxy;
 
 struct SharedState {
   notary_signing_key: SigningKey,
+  ws_proxy:           websocket_proxy::ProxyState,
 }
 
 /// Main entry point for the notary server application.
@@ -71,7 +82,9 @@ struct SharedState {
 #[tokio::main]
 async fn main() -> Result<(), NotaryServerError> {
   tracing_subscriber::registry()
-    .with(tracing_subscriber::fmt::layer().with_line_number(true))
+    // Logs go to stderr so stdout stays reserved for machine-readable output such as the
+    // proxy's NDJSON connection events.
+    .with(tracing_subscriber::fmt::layer().with_line_number(true).with_writer(std::io::stderr))
     .with(tracing_subscriber::EnvFilter::from_default_env()) // set via RUST_LOG=INFO etc
     .init();
 
@@ -84,18 +97,73 @@ async fn main() -> Result<(), NotaryServerError> {
   let listener = TcpListener::bind(&c.listen).await?;
   info!("Listening on https://{}", &c.listen);
 
-  let shared_state =
-    Arc::new(SharedState { notary_signing_key: load_notary_signing_key(&c.notary_signing_key) });
+  let shared_state = Arc::new(SharedState {
+    notary_signing_key: load_notary_signing_key(&c.notary_signing_key),
+    ws_proxy:           websocket_proxy::ProxyState::new(c.websocket_proxy.clone()),
+  });
+
+  // Graceful shutdown: the first SIGINT or SIGTERM (as sent by rolling deploys) flips
+  // /health to 503 so load balancers stop routing here, begins age-based draining of proxy
+  // connections, and exits once the live tunnels are gone or the grace period is up.
+  {
+    let drain = shared_state.ws_proxy.drain.clone();
+    let grace = std::time::Duration::from_millis(c.shutdown_timeout_ms);
+    tokio::spawn(async move {
+      let mut sigterm = tokio::signal::unix::signal(tokio::signal::unix::SignalKind::terminate())
+        .expect("installing a SIGTERM handler cannot fail");
+      let mut sigint = tokio::signal::unix::signal(tokio::signal::unix::SignalKind::interrupt())
+        .expect("installing a SIGINT handler cannot fail");
+      tokio::select! {
+        _ = sigterm.recv() => info!("SIGTERM received, shutting down gracefully"),
+        _ = sigint.recv() => info!("SIGINT received, shutting down gracefully"),
+      }
+      drain.begin_drain();
+      if drain.wait_idle(grace).await {
+        info!("all proxied connections finished, exiting");
+      } else {
+        info!(
+          "shutdown grace period elapsed with {} connections still active, exiting",
+          drain.active_connections()
+        );
+      }
+      std::process::exit(0);
+    });
+  }
+
+  // Debug endpoints live on a separate plain-HTTP listener that only ever binds loopback,
+  // so profiling and stats can be scraped from the box under load without exposing them on
+  // the public interface.
+  if !c.admin_addr.is_empty() {
+    if !config::is_loopback_addr(&c.admin_addr) {
+      error!("admin_addr {} is not a loopback address; refusing to serve it", c.admin_addr);
+    } else {
+      let admin_router = Router::new()
+        .route("/health", get(health))
+        .route("/debug/stats", get(websocket_proxy::proxy_stats))
+        .route("/debug/metrics", get(websocket_proxy::prometheus_metrics))
+        .with_state(shared_state.clone());
+      let admin_listener = TcpListener::bind(&c.admin_addr).await?;
+      info!("Admin endpoints on http://{}", &c.admin_addr);
+      tokio::spawn(async move {
+        if let Err(e) = axum::serve(admin_listener, admin_router).await {
+          error!("admin listener error: {}", e);
+        }
+      });
+    }
+  }
 
   let router = Router::new()
-    .route("/health", get(|| async move { (StatusCode::OK, "Ok").into_response() }))
+    .route("/health", get(health))
     .route("/v1/proxy", post(proxy::proxy))
+    .route("/v1/websocket-proxy", get(websocket_proxy::websocket_proxy))
+    .route("/v1/websocket-proxy/stats", get(websocket_proxy::proxy_stats))
+    .route("/metrics", get(websocket_proxy::prometheus_metrics))
     .route("/v1/meta/keys/:key", get(meta_keys))
     .layer(CorsLayer::permissive())
     .with_state(shared_state);
 
   if !c.server_cert.is_empty() || !c.server_key.is_empty() {
-    let _ = listen(listener, router, &c.server_cert, &c.server_key).await;
+    let _ = listen(listener, router, &c.server_cert, &c.server_key, c.tls_watch).await;
   } else {
     let _ = acme_listen(listener, router, &c.acme_domain, &c.acme_email).await;
   }
@@ -255,27 +323,43 @@ async fn listen(
   router: Router,
   server_cert_path: &str,
   server_key_path: &str,
+  tls_watch: bool,
 ) -> Result<(), NotaryServerError> {
   let protocol = Arc::new(http1::Builder::new());
 
   info!("Using {} and {}", server_cert_path, server_key_path);
-  let certs = match load_certs(server_cert_path) {
-    Ok(certs) => certs,
-    Err(e) => {
-      error!("Failed to load certificates: {}", e);
-      return Err(NotaryServerError::CertificateError(e.to_string()));
-    },
-  };
+  let server_config = if tls_watch {
+    // Resolve the certificate per handshake so rotated certs are picked up by new
+    // connections without restarting or dropping established ones.
+    let resolver = match tls::ReloadingCertResolver::load(server_cert_path, server_key_path) {
+      Ok(resolver) => resolver,
+      Err(e) => {
+        error!("Failed to load certificates: {}", e);
+        return Err(NotaryServerError::CertificateError(e.to_string()));
+      },
+    };
+    resolver.clone().spawn_watcher();
+    info!("TLS certificate watch enabled");
+    let mut config = ServerConfig::builder().with_no_client_auth().with_cert_resolver(resolver);
+    config.alpn_protocols = vec![b"http/1.1".to_vec()];
+    config
+  } else {
+    let certs = match load_certs(server_cert_path) {
+      Ok(certs) => certs,
+      Err(e) => {
+        error!("Failed to load certificates: {}", e);
+        return Err(NotaryServerError::CertificateError(e.to_string()));
+      },
+    };
 
-  let key = match load_private_key(server_key_path) {
-    Ok(key) => key,
-    Err(e) => {
-      error!("Failed to load private key: {}", e);
-      return Err(NotaryServerError::CertificateError(e.to_string()));
-    },
-  };
+    let key = match load_private_key(server_key_path) {
+      Ok(key) => key,
+      Err(e) => {
+        error!("Failed to load private key: {}", e);
+        return Err(NotaryServerError::CertificateError(e.to_string()));
+      },
+    };
 
-  let server_config =
     match ServerConfig::builder().with_no_client_auth().with_single_cert(certs, key) {
       Ok(config) => {
         let mut config = config;
@@ -286,7 +370,8 @@ async fn listen(
         error!("Failed to create server config: {}", e);
         return Err(NotaryServerError::ServerConfigError(e.to_string()));
       },
-    };
+    }
+  };
 
   let tls_acceptor = TlsAcceptor::from(Arc::new(server_config));
 
@@ -349,6 +434,16 @@ pub fn load_notary_signing_key(private_key_pem_path: &str) -> SigningKey {
 
 pub fn ephemeral_notary_signing_key() -> SigningKey { SigningKey::random(&mut rand_core::OsRng) }
 
+/// Liveness endpoint. Answers 503 once shutdown has begun so load balancers stop routing
+/// new work to an instance that is draining its connections.
+async fn health(State(state): State<Arc<SharedState>>) -> impl IntoResponse {
+  if state.ws_proxy.drain.is_draining() {
+    (StatusCode::SERVICE_UNAVAILABLE, "draining")
+  } else {
+    (StatusCode::OK, "Ok")
+  }
+}
+
 async fn meta_keys(
   Path(key): Path<String>,
   State(state): State<Arc<SharedState>>,
@@ -0,0 +1,93 @@
+//! Per-client-IP byte budgets for the WebSocket proxy, tracked across connections so
+//! reconnecting does not reset the meter.
+
+use std::{
+  collections::HashMap,
+  net::IpAddr,
+  sync::Mutex,
+  time::{Duration, Instant},
+};
+
+/// Tracks bytes transferred per client IP over a rolling window. Once an IP exceeds the
+/// budget, new connections are refused and in-flight ones are closed at the quota boundary;
+/// the meter resets when the window elapses.
+pub struct ByteQuota {
+  quota:  u64,
+  window: Duration,
+  usage:  Mutex<HashMap<IpAddr, Usage>>,
+}
+
+struct Usage {
+  bytes:        u64,
+  window_start: Instant,
+}
+
+impl ByteQuota {
+  pub fn new(quota: u64, window: Duration) -> Self {
+    Self { quota, window, usage: Mutex::new(HashMap::new()) }
+  }
+
+  /// Records `n` bytes against `ip`'s budget, returning whether the IP is still within it.
+  pub fn record(&self, ip: IpAddr, n: u64) -> bool {
+    let now = Instant::now();
+    let mut usage = self.usage.lock().unwrap();
+    let entry = usage.entry(ip).or_insert(Usage { bytes: 0, window_start: now });
+    if now.duration_since(entry.window_start) >= self.window {
+      entry.bytes = 0;
+      entry.window_start = now;
+    }
+    entry.bytes = entry.bytes.saturating_add(n);
+    entry.bytes <= self.quota
+  }
+
+  /// Whether a new connection from `ip` is admissible. Also drops entries whose window has
+  /// expired, so the map does not grow with every IP ever seen.
+  pub fn admits(&self, ip: IpAddr) -> bool {
+    let now = Instant::now();
+    let mut usage = self.usage.lock().unwrap();
+    usage.retain(|_, entry| now.duration_since(entry.window_start) < self.window);
+    usage.get(&ip).map_or(true, |entry| entry.bytes <= self.quota)
+  }
+}
+
+#[cfg(test)]
+mod tests {
+  use std::{net::IpAddr, time::Duration};
+
+  use super::ByteQuota;
+
+  fn ip(s: &str) -> IpAddr { s.parse().unwrap() }
+
+  #[test]
+  fn transfers_past_the_quota_are_flagged_and_block_new_connections() {
+    let quota = ByteQuota::new(100, Duration::from_secs(60));
+    assert!(quota.record(ip("203.0.113.5"), 60));
+    assert!(quota.record(ip("203.0.113.5"), 40));
+    // The next byte tips this IP over its budget.
+    assert!(!quota.record(ip("203.0.113.5"), 1));
+    assert!(!quota.admits(ip("203.0.113.5")));
+
+    // Other IPs are unaffected.
+    assert!(quota.admits(ip("203.0.113.6")));
+    assert!(quota.record(ip("203.0.113.6"), 60));
+  }
+
+  #[test]
+  fn budget_resets_once_the_window_elapses() {
+    let quota = ByteQuota::new(100, Duration::from_millis(20));
+    assert!(!quota.record(ip("203.0.113.5"), 150));
+    std::thread::sleep(Duration::from_millis(25));
+    assert!(quota.admits(ip("203.0.113.5")));
+    assert!(quota.record(ip("203.0.113.5"), 50));
+  }
+
+  #[test]
+  fn stale_entries_are_collected() {
+    let quota = ByteQuota::new(100, Duration::from_millis(10));
+    quota.record(ip("203.0.113.5"), 10);
+    quota.record(ip("203.0.113.6"), 10);
+    std::thread::sleep(Duration::from_millis(15));
+    quota.admits(ip("203.0.113.7"));
+    assert!(quota.usage.lock().unwrap().is_empty());
+  }
+}
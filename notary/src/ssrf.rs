@@ -0,0 +1,223 @@
+//! SSRF guard for the websocket proxy: validates resolved target addresses before the proxy
+//! dials them, so the notary cannot be used to reach internal services.
+
+use std::net::IpAddr;
+
+use tracing::warn;
+
+/// Why a proxy target was rejected. Each category maps to a labeled counter in the proxy
+/// stats so operators can distinguish abuse from misconfiguration.
+#[derive(Clone, Copy, Debug, PartialEq, Eq, Hash)]
+pub enum SsrfRejection {
+  Loopback,
+  PrivateRange,
+  LinkLocal,
+  CgnatRange,
+  UniqueLocal,
+  DeniedCidr,
+}
+
+impl SsrfRejection {
+  /// Stable label used as the counter key in the proxy stats.
+  pub fn label(&self) -> &'static str {
+    match self {
+      SsrfRejection::Loopback => "loopback",
+      SsrfRejection::PrivateRange => "private_range",
+      SsrfRejection::LinkLocal => "link_local",
+      SsrfRejection::CgnatRange => "cgnat_range",
+      SsrfRejection::UniqueLocal => "unique_local",
+      SsrfRejection::DeniedCidr => "denied_cidr",
+    }
+  }
+}
+
+/// A parsed CIDR block, e.g. `10.0.0.0/8` or `fc00::/7`.
+#[derive(Clone, Debug)]
+pub struct Cidr {
+  network:    u128,
+  prefix_len: u8,
+  is_ipv4:    bool,
+}
+
+impl Cidr {
+  pub fn parse(s: &str) -> Option<Self> {
+    let (addr, prefix) = s.split_once('/')?;
+    let addr: IpAddr = addr.parse().ok()?;
+    let prefix_len: u8 = prefix.parse().ok()?;
+    let (bits, width, is_ipv4) = match addr {
+      IpAddr::V4(v4) => (u32::from(v4) as u128, 32, true),
+      IpAddr::V6(v6) => (u128::from(v6), 128, false),
+    };
+    if prefix_len > width {
+      return None;
+    }
+    Some(Self { network: bits & Self::mask(prefix_len, width), prefix_len, is_ipv4 })
+  }
+
+  pub fn contains(&self, ip: &IpAddr) -> bool {
+    let (bits, width) = match ip {
+      IpAddr::V4(v4) => (u32::from(*v4) as u128, 32),
+      IpAddr::V6(v6) => (u128::from(*v6), 128),
+    };
+    if self.is_ipv4 != (width == 32) {
+      return false;
+    }
+    bits & Self::mask(self.prefix_len, width) == self.network
+  }
+
+  fn mask(prefix_len: u8, width: u8) -> u128 {
+    if prefix_len == 0 {
+      0
+    } else {
+      (!0u128) << (128 - prefix_len) >> (128 - width)
+    }
+  }
+}
+
+/// Validates target IPs against loopback and private ranges plus an operator-supplied CIDR
+/// denylist.
+#[derive(Debug, Default)]
+pub struct SsrfGuard {
+  denied_cidrs: Vec<Cidr>,
+}
+
+impl SsrfGuard {
+  /// Builds a guard from configured denylist CIDR strings; invalid entries are logged and
+  /// skipped rather than silently tightening or loosening the policy.
+  pub fn new(denied_cidrs: &[String]) -> Self {
+    let denied_cidrs = denied_cidrs
+      .iter()
+      .filter_map(|s| {
+        let cidr = Cidr::parse(s);
+        if cidr.is_none() {
+          warn!("ignoring invalid denied_cidrs entry: {}", s);
+        }
+        cidr
+      })
+      .collect();
+    Self { denied_cidrs }
+  }
+
+  /// Checks a single resolved IP. Targets resolving to multiple IPs must have every IP pass.
+  pub fn check_ip(&self, ip: IpAddr) -> Result<(), SsrfRejection> {
+    // An IPv4-mapped IPv6 address (`::ffff:a.b.c.d`) reaches the IPv4 endpoint it names on
+    // a dual-stack host, so it is checked as that IPv4 address — otherwise the mapping
+    // smuggles loopback and private ranges past every check below.
+    let ip = match ip {
+      IpAddr::V6(v6) => v6.to_ipv4_mapped().map_or(ip, IpAddr::V4),
+      IpAddr::V4(_) => ip,
+    };
+    if ip.is_loopback() {
+      return Err(SsrfRejection::Loopback);
+    }
+    match ip {
+      IpAddr::V4(v4) => {
+        if v4.is_private() {
+          return Err(SsrfRejection::PrivateRange);
+        }
+        if v4.is_link_local() {
+          return Err(SsrfRejection::LinkLocal);
+        }
+        // Carrier-grade NAT, 100.64.0.0/10 (RFC 6598): not covered by `is_private`, but
+        // internal to the hosting network just the same.
+        let octets = v4.octets();
+        if octets[0] == 100 && (octets[1] & 0xc0) == 64 {
+          return Err(SsrfRejection::CgnatRange);
+        }
+      },
+      IpAddr::V6(v6) => {
+        let segments = v6.segments();
+        // Link-local, fe80::/10.
+        if (segments[0] & 0xffc0) == 0xfe80 {
+          return Err(SsrfRejection::LinkLocal);
+        }
+        // Unique local addresses, fc00::/7 (RFC 4193): the IPv6 analogue of private ranges.
+        if (segments[0] & 0xfe00) == 0xfc00 {
+          return Err(SsrfRejection::UniqueLocal);
+        }
+      },
+    }
+    if self.denied_cidrs.iter().any(|cidr| cidr.contains(&ip)) {
+      return Err(SsrfRejection::DeniedCidr);
+    }
+    Ok(())
+  }
+}
+
+#[cfg(test)]
+mod tests {
+  use super::*;
+
+  fn ip(s: &str) -> IpAddr { s.parse().unwrap() }
+
+  #[test]
+  fn loopback_is_rejected() {
+    let guard = SsrfGuard::default();
+    assert_eq!(guard.check_ip(ip("127.0.0.1")), Err(SsrfRejection::Loopback));
+    assert_eq!(guard.check_ip(ip("::1")), Err(SsrfRejection::Loopback));
+  }
+
+  #[test]
+  fn private_ranges_are_rejected() {
+    let guard = SsrfGuard::default();
+    assert_eq!(guard.check_ip(ip("10.1.2.3")), Err(SsrfRejection::PrivateRange));
+    assert_eq!(guard.check_ip(ip("172.16.0.1")), Err(SsrfRejection::PrivateRange));
+    assert_eq!(guard.check_ip(ip("192.168.1.1")), Err(SsrfRejection::PrivateRange));
+  }
+
+  #[test]
+  fn internal_ranges_beyond_is_private_are_rejected() {
+    let guard = SsrfGuard::default();
+    // (address, why it must never be dialable from the notary)
+    let rejected = [
+      ("169.254.169.254", SsrfRejection::LinkLocal), // cloud metadata endpoint
+      ("169.254.0.1", SsrfRejection::LinkLocal),
+      ("fe80::1", SsrfRejection::LinkLocal),
+      ("100.64.0.1", SsrfRejection::CgnatRange), // CGNAT, RFC 6598
+      ("100.127.255.254", SsrfRejection::CgnatRange),
+      ("fc00::1", SsrfRejection::UniqueLocal), // IPv6 ULA, RFC 4193
+      ("fd12:3456:789a::1", SsrfRejection::UniqueLocal),
+    ];
+    for (addr, rejection) in rejected {
+      assert_eq!(guard.check_ip(ip(addr)), Err(rejection), "{} must be rejected", addr);
+    }
+
+    // Neighbors just outside those ranges stay reachable.
+    for addr in ["100.63.255.254", "100.128.0.1", "fe00::1"] {
+      assert_eq!(guard.check_ip(ip(addr)), Ok(()), "{} must pass", addr);
+    }
+  }
+
+  #[test]
+  fn denied_cidr_is_rejected() {
+    let guard = SsrfGuard::new(&["203.0.113.0/24".to_string(), "2001:db8::/32".to_string()]);
+    assert_eq!(guard.check_ip(ip("203.0.113.7")), Err(SsrfRejection::DeniedCidr));
+    assert_eq!(guard.check_ip(ip("2001:db8::1")), Err(SsrfRejection::DeniedCidr));
+    assert_eq!(guard.check_ip(ip("203.0.114.7")), Ok(()));
+  }
+
+  #[test]
+  fn ipv4_mapped_ipv6_is_checked_as_the_ipv4_address_it_names() {
+    let guard = SsrfGuard::new(&["203.0.113.0/24".to_string()]);
+    assert_eq!(guard.check_ip(ip("::ffff:127.0.0.1")), Err(SsrfRejection::Loopback));
+    assert_eq!(guard.check_ip(ip("::ffff:10.0.0.1")), Err(SsrfRejection::PrivateRange));
+    assert_eq!(guard.check_ip(ip("::ffff:169.254.169.254")), Err(SsrfRejection::LinkLocal));
+    assert_eq!(guard.check_ip(ip("::ffff:100.64.0.1")), Err(SsrfRejection::CgnatRange));
+    assert_eq!(guard.check_ip(ip("::ffff:203.0.113.7")), Err(SsrfRejection::DeniedCidr));
+    // A mapped public address is as reachable as its IPv4 form.
+    assert_eq!(guard.check_ip(ip("::ffff:93.184.216.34")), Ok(()));
+  }
+
+  #[test]
+  fn public_addresses_pass() {
+    let guard = SsrfGuard::new(&["203.0.113.0/24".to_string()]);
+    assert_eq!(guard.check_ip(ip("93.184.216.34")), Ok(()));
+    assert_eq!(guard.check_ip(ip("2606:2800:220:1::1")), Ok(()));
+  }
+
+  #[test]
+  fn invalid_cidr_entries_are_skipped() {
+    let guard = SsrfGuard::new(&["not-a-cidr".to_string()]);
+    assert_eq!(guard.check_ip(ip("93.184.216.34")), Ok(()));
+  }
+}
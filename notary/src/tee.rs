@@ -0,0 +1,180 @@
+use async_trait::async_trait;
+use base64::Engine;
+use serde_json::Value;
+use web_prover_core::hash::keccak_digest;
+
+use crate::error::NotaryServerError;
+
+/// Byte-length bounds, inclusive, the attestation service accepts for an `eat_nonce`.
+pub const NONCE_MIN_LEN: usize = 10;
+pub const NONCE_MAX_LEN: usize = 74;
+
+/// Computes the nonce an attestation should commit to for a web-proof blob: the keccak256
+/// digest of the raw blob bytes — the same hash the rest of the pipeline uses for proof
+/// material — hex-encoded. At 64 characters the result always sits inside the
+/// [`NONCE_MIN_LEN`]..=[`NONCE_MAX_LEN`] window, so a nonce produced here can be submitted
+/// to the attestation service as-is.
+pub fn nonce_for(blob: &[u8]) -> String { hex::encode(keccak_digest(blob)) }
+
+/// Whether `nonce` has a byte length the attestation service will accept.
+pub fn nonce_length_valid(nonce: &str) -> bool {
+  (NONCE_MIN_LEN..=NONCE_MAX_LEN).contains(&nonce.len())
+}
+
+/// Client for fetching the attestation token of the running TEE.
+///
+/// Abstracted behind a trait so request gating logic can be tested against a stub without a
+/// real attestation agent.
+#[async_trait]
+pub trait AttestationClient: Send + Sync {
+  /// Fetches the current attestation token, e.g. from the local attestation agent.
+  async fn fetch_token(&self) -> Result<String, NotaryServerError>;
+}
+
+/// Fetches the attestation token from a local attestation agent over HTTP.
+pub struct HttpAttestationClient {
+  pub endpoint: String,
+}
+
+#[async_trait]
+impl AttestationClient for HttpAttestationClient {
+  async fn fetch_token(&self) -> Result<String, NotaryServerError> {
+    let response = reqwest::get(&self.endpoint).await.map_err(|e| {
+      NotaryServerError::AttestationError(format!("failed to fetch attestation token: {}", e))
+    })?;
+    response.text().await.map_err(|e| {
+      NotaryServerError::AttestationError(format!("failed to read attestation token: {}", e))
+    })
+  }
+}
+
+/// Extracts the `eat_nonce` claim from an attestation token in JWT format.
+///
+/// The token is not verified here; callers only need the nonce that the attestation service
+/// bound into the token it signed.
+pub fn nonce_from_token(token: &str) -> Option<String> {
+  let payload = token.split('.').nth(1)?;
+  let bytes = base64::engine::general_purpose::URL_SAFE_NO_PAD.decode(payload).ok()?;
+  let claims: Value = serde_json::from_slice(&bytes).ok()?;
+  match claims.get("eat_nonce")? {
+    Value::String(nonce) => Some(nonce.clone()),
+    // Some attestation services encode multiple nonces as an array; use the first.
+    Value::Array(nonces) => nonces.first().and_then(|n| n.as_str()).map(str::to_string),
+    _ => None,
+  }
+}
+
+/// An attestation token decomposed into the fields an on-chain verifier consumes, both
+/// hex-encoded with a `0x` prefix so they can be pasted into ABI tooling directly.
+///
+/// Per JWS (RFC 7515), the signature covers the ASCII bytes of
+/// `base64url(header) "." base64url(payload)` — the first two token segments and the dot
+/// between them, exactly as they appear on the wire, not the decoded JSON. A Solidity
+/// verifier must hash `signed_payload` verbatim when checking `signature`.
+#[derive(Debug, PartialEq, Eq, serde::Serialize)]
+pub struct OnchainToken {
+  /// Hex of the signed bytes: the `header.payload` prefix of the JWT, as ASCII.
+  pub signed_payload: String,
+  /// Hex of the decoded signature segment.
+  pub signature:      String,
+}
+
+/// Decomposes a JWT-format attestation token into its on-chain form, or `None` when the
+/// token is not a well-formed signed JWT. The token is not verified here — that is the
+/// on-chain verifier's job — but each segment must decode, so garbage never leaves this
+/// function hex-dressed as a token.
+pub fn onchain_token(token: &str) -> Option<OnchainToken> {
+  let decode = |segment: &str| {
+    base64::engine::general_purpose::URL_SAFE_NO_PAD.decode(segment).ok().filter(|b| !b.is_empty())
+  };
+  let mut segments = token.split('.');
+  let (header, payload, signature) = (segments.next()?, segments.next()?, segments.next()?);
+  if segments.next().is_some() {
+    return None;
+  }
+  decode(header)?;
+  decode(payload)?;
+  let signature = decode(signature)?;
+  Some(OnchainToken {
+    signed_payload: format!("0x{}", hex::encode(format!("{}.{}", header, payload))),
+    signature:      format!("0x{}", hex::encode(signature)),
+  })
+}
+
+#[cfg(test)]
+mod tests {
+  use base64::Engine;
+
+  use super::*;
+
+  /// Builds an unsigned JWT-shaped token with the given claims payload.
+  pub fn test_token(claims: &serde_json::Value) -> String {
+    let encode = |bytes: &[u8]| base64::engine::general_purpose::URL_SAFE_NO_PAD.encode(bytes);
+    format!("{}.{}.{}", encode(b"{\"alg\":\"none\"}"), encode(claims.to_string().as_bytes()), "")
+  }
+
+  #[test]
+  fn extracts_string_nonce() {
+    let token = test_token(&serde_json::json!({ "eat_nonce": "abc123" }));
+    assert_eq!(nonce_from_token(&token), Some("abc123".to_string()));
+  }
+
+  #[test]
+  fn extracts_first_nonce_from_array() {
+    let token = test_token(&serde_json::json!({ "eat_nonce": ["first", "second"] }));
+    assert_eq!(nonce_from_token(&token), Some("first".to_string()));
+  }
+
+  #[test]
+  fn missing_nonce_yields_none() {
+    let token = test_token(&serde_json::json!({ "sub": "tee" }));
+    assert_eq!(nonce_from_token(&token), None);
+  }
+
+  #[test]
+  fn malformed_token_yields_none() {
+    assert_eq!(nonce_from_token("not-a-jwt"), None);
+  }
+
+  #[test]
+  fn onchain_format_decodes_back_to_the_signed_bytes_and_signature() {
+    let encode = |bytes: &[u8]| base64::engine::general_purpose::URL_SAFE_NO_PAD.encode(bytes);
+    let header = encode(b"{\"alg\":\"ES256\"}");
+    let payload = encode(b"{\"eat_nonce\":\"abc123\"}");
+    let token = format!("{}.{}.{}", header, payload, encode(&[0xde, 0xad, 0xbe, 0xef]));
+
+    let onchain = onchain_token(&token).unwrap();
+    let signed = hex::decode(onchain.signed_payload.strip_prefix("0x").unwrap()).unwrap();
+    assert_eq!(signed, format!("{}.{}", header, payload).into_bytes());
+    let signature = hex::decode(onchain.signature.strip_prefix("0x").unwrap()).unwrap();
+    assert_eq!(signature, [0xde, 0xad, 0xbe, 0xef]);
+  }
+
+  #[test]
+  fn nonce_for_a_known_blob_is_stable_and_within_the_accepted_length() {
+    let first = nonce_for(b"web proof blob");
+    let again = nonce_for(b"web proof blob");
+    assert_eq!(first, again);
+    assert_eq!(first.len(), 64);
+    assert!(nonce_length_valid(&first));
+    // A different blob commits to a different nonce.
+    assert_ne!(first, nonce_for(b"another blob"));
+  }
+
+  #[test]
+  fn nonce_length_bounds_are_inclusive() {
+    assert!(nonce_length_valid(&"a".repeat(10)));
+    assert!(nonce_length_valid(&"a".repeat(74)));
+    assert!(!nonce_length_valid(&"a".repeat(9)));
+    assert!(!nonce_length_valid(&"a".repeat(75)));
+  }
+
+  #[test]
+  fn unsigned_or_malformed_tokens_have_no_onchain_form() {
+    // `test_token` produces an empty signature segment; nothing to submit on-chain.
+    let unsigned = test_token(&serde_json::json!({ "eat_nonce": "abc123" }));
+    assert!(onchain_token(&unsigned).is_none());
+    assert!(onchain_token("not-a-jwt").is_none());
+    assert!(onchain_token("a.b.c.d").is_none());
+  }
+}
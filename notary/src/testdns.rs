@@ -0,0 +1,182 @@
+//! A stub DNS server for resolver tests: answers A/AAAA queries with configurable records
+//! after a configurable delay, so resolution timeouts and IP selection can be exercised
+//! deterministically without touching real DNS.
+
+use std::{
+  net::{IpAddr, Ipv4Addr, Ipv6Addr, SocketAddr},
+  time::Duration,
+};
+
+use tokio::net::UdpSocket;
+
+pub const TYPE_A: u16 = 1;
+pub const TYPE_AAAA: u16 = 28;
+
+/// Records the stub serves, with the latency applied before every answer.
+#[derive(Default)]
+pub struct DnsRecords {
+  pub a:       Vec<Ipv4Addr>,
+  pub aaaa:    Vec<Ipv6Addr>,
+  pub latency: Duration,
+}
+
+/// Starts the stub on an ephemeral UDP port and returns its address.
+pub async fn start(records: DnsRecords) -> SocketAddr {
+  let socket = UdpSocket::bind("127.0.0.1:0").await.unwrap();
+  let addr = socket.local_addr().unwrap();
+  tokio::spawn(async move {
+    let mut buf = [0u8; 512];
+    loop {
+      let Ok((n, peer)) = socket.recv_from(&mut buf).await else { break };
+      tokio::time::sleep(records.latency).await;
+      let response = answer(&buf[..n], &records);
+      let _ = socket.send_to(&response, peer).await;
+    }
+  });
+  addr
+}
+
+/// Builds a response to `query`, echoing the question and answering with every record of
+/// the queried type.
+fn answer(query: &[u8], records: &DnsRecords) -> Vec<u8> {
+  // Question starts at offset 12: labels, a zero byte, then QTYPE and QCLASS.
+  let mut qname_end = 12;
+  while query[qname_end] != 0 {
+    qname_end += query[qname_end] as usize + 1;
+  }
+  let question = &query[12..qname_end + 5];
+  let qtype = u16::from_be_bytes([query[qname_end + 1], query[qname_end + 2]]);
+
+  let mut rdata: Vec<Vec<u8>> = Vec::new();
+  if qtype == TYPE_A {
+    rdata.extend(records.a.iter().map(|ip| ip.octets().to_vec()));
+  }
+  if qtype == TYPE_AAAA {
+    rdata.extend(records.aaaa.iter().map(|ip| ip.octets().to_vec()));
+  }
+
+  let mut response = Vec::new();
+  response.extend_from_slice(&query[..2]);
+  // Standard response, recursion desired + available, no error.
+  response.extend_from_slice(&[0x81, 0x80]);
+  response.extend_from_slice(&1u16.to_be_bytes());
+  response.extend_from_slice(&(rdata.len() as u16).to_be_bytes());
+  response.extend_from_slice(&[0, 0, 0, 0]);
+  response.extend_from_slice(question);
+  for data in rdata {
+    // Compression pointer back to the question name.
+    response.extend_from_slice(&[0xc0, 0x0c]);
+    response.extend_from_slice(&qtype.to_be_bytes());
+    response.extend_from_slice(&1u16.to_be_bytes());
+    response.extend_from_slice(&60u32.to_be_bytes());
+    response.extend_from_slice(&(data.len() as u16).to_be_bytes());
+    response.extend_from_slice(&data);
+  }
+  response
+}
+
+/// Sends one query to `server` and returns the answered IPs in answer order, or a
+/// `TimedOut` error if no response arrives within `timeout`.
+pub async fn query(
+  server: SocketAddr,
+  name: &str,
+  qtype: u16,
+  timeout: Duration,
+) -> std::io::Result<Vec<IpAddr>> {
+  let socket = UdpSocket::bind("127.0.0.1:0").await?;
+
+  let mut packet = vec![0x12, 0x34, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0];
+  for label in name.split('.') {
+    packet.push(label.len() as u8);
+    packet.extend_from_slice(label.as_bytes());
+  }
+  packet.push(0);
+  packet.extend_from_slice(&qtype.to_be_bytes());
+  packet.extend_from_slice(&1u16.to_be_bytes());
+  socket.send_to(&packet, server).await?;
+
+  let mut buf = [0u8; 512];
+  let (n, _) = tokio::time::timeout(timeout, socket.recv_from(&mut buf))
+    .await
+    .map_err(|_| std::io::Error::new(std::io::ErrorKind::TimedOut, "dns query timed out"))??;
+  Ok(parse_answers(&buf[..n]))
+}
+
+fn parse_answers(packet: &[u8]) -> Vec<IpAddr> {
+  let ancount = u16::from_be_bytes([packet[6], packet[7]]) as usize;
+  let mut i = 12;
+  while packet[i] != 0 {
+    i += packet[i] as usize + 1;
+  }
+  i += 5;
+
+  let mut ips = Vec::new();
+  for _ in 0..ancount {
+    i += 2; // compression pointer
+    let rtype = u16::from_be_bytes([packet[i], packet[i + 1]]);
+    i += 8; // type, class, ttl
+    let rdlen = u16::from_be_bytes([packet[i], packet[i + 1]]) as usize;
+    i += 2;
+    match (rtype, rdlen) {
+      (TYPE_A, 4) => ips.push(IpAddr::from(<[u8; 4]>::try_from(&packet[i..i + 4]).unwrap())),
+      (TYPE_AAAA, 16) => ips.push(IpAddr::from(<[u8; 16]>::try_from(&packet[i..i + 16]).unwrap())),
+      _ => {},
+    }
+    i += rdlen;
+  }
+  ips
+}
+
+#[cfg(test)]
+mod tests {
+  use std::time::Duration;
+
+  use super::{query, start, DnsRecords, TYPE_A, TYPE_AAAA};
+
+  #[tokio::test]
+  async fn a_records_come_back_in_configured_order() {
+    let server = start(DnsRecords {
+      a: vec!["192.0.2.1".parse().unwrap(), "192.0.2.2".parse().unwrap()],
+      ..DnsRecords::default()
+    })
+    .await;
+
+    let ips = query(server, "target.example.com", TYPE_A, Duration::from_secs(1)).await.unwrap();
+    assert_eq!(ips.len(), 2);
+    // A resolve-then-pin dialer uses the first record, so order matters.
+    assert_eq!(ips[0], "192.0.2.1".parse::<std::net::IpAddr>().unwrap());
+    assert_eq!(ips[1], "192.0.2.2".parse::<std::net::IpAddr>().unwrap());
+  }
+
+  #[tokio::test]
+  async fn aaaa_records_are_served_separately() {
+    let server = start(DnsRecords {
+      a: vec!["192.0.2.1".parse().unwrap()],
+      aaaa: vec!["2001:db8::1".parse().unwrap()],
+      ..DnsRecords::default()
+    })
+    .await;
+
+    let ips = query(server, "target.example.com", TYPE_AAAA, Duration::from_secs(1)).await.unwrap();
+    assert_eq!(ips, vec!["2001:db8::1".parse::<std::net::IpAddr>().unwrap()]);
+  }
+
+  #[tokio::test]
+  async fn slow_answers_trip_a_short_resolution_timeout() {
+    let server = start(DnsRecords {
+      a: vec!["192.0.2.1".parse().unwrap()],
+      latency: Duration::from_millis(200),
+      ..DnsRecords::default()
+    })
+    .await;
+
+    let err = query(server, "target.example.com", TYPE_A, Duration::from_millis(20))
+      .await
+      .expect_err("the slow answer must not beat the timeout");
+    assert_eq!(err.kind(), std::io::ErrorKind::TimedOut);
+
+    // The same server answers fine when the timeout budget covers its latency.
+    let ips = query(server, "target.example.com", TYPE_A, Duration::from_secs(1)).await.unwrap();
+    assert_eq!(ips.len(), 1);
+  }
+}
@@ -0,0 +1,112 @@
+use std::{
+  fs, io,
+  path::Path,
+  sync::{Arc, RwLock},
+  time::{Duration, SystemTime},
+};
+
+use rustls::{
+  server::{ClientHello, ResolvesServerCert},
+  sign::CertifiedKey,
+};
+use tracing::{error, info};
+
+/// How often the watcher checks the cert/key files for changes.
+const WATCH_INTERVAL: Duration = Duration::from_secs(2);
+
+/// Certificate resolver that can swap in a re-read certificate without restarting the
+/// server or dropping connections: new handshakes pick up the new certificate while
+/// established connections keep the one they were handshaken with.
+#[derive(Debug)]
+pub struct ReloadingCertResolver {
+  cert_path: String,
+  key_path:  String,
+  certified: RwLock<Arc<CertifiedKey>>,
+}
+
+impl ReloadingCertResolver {
+  /// Loads the certificate and key from disk and returns the resolver.
+  pub fn load(cert_path: &str, key_path: &str) -> io::Result<Arc<Self>> {
+    let certified = Arc::new(load_certified_key(cert_path, key_path)?);
+    Ok(Arc::new(Self {
+      cert_path: cert_path.to_string(),
+      key_path:  key_path.to_string(),
+      certified: RwLock::new(certified),
+    }))
+  }
+
+  /// Re-reads the certificate and key, swapping them in for future handshakes.
+  pub fn reload(&self) -> io::Result<()> {
+    let certified = Arc::new(load_certified_key(&self.cert_path, &self.key_path)?);
+    *self.certified.write().unwrap() = certified;
+    Ok(())
+  }
+
+  pub fn current(&self) -> Arc<CertifiedKey> { self.certified.read().unwrap().clone() }
+
+  /// Watches the cert/key files via periodic stat and reloads on any modification-time
+  /// change. A failed reload keeps serving the previous certificate.
+  pub fn spawn_watcher(self: Arc<Self>) {
+    tokio::spawn(async move {
+      let mut last = (modified_at(&self.cert_path), modified_at(&self.key_path));
+      loop {
+        tokio::time::sleep(WATCH_INTERVAL).await;
+        let current = (modified_at(&self.cert_path), modified_at(&self.key_path));
+        if current != last {
+          last = current;
+          match self.reload() {
+            Ok(()) => info!("reloaded TLS certificate from {}", self.cert_path),
+            Err(e) => error!("failed to reload TLS certificate: {}", e),
+          }
+        }
+      }
+    });
+  }
+}
+
+impl ResolvesServerCert for ReloadingCertResolver {
+  fn resolve(&self, _client_hello: ClientHello<'_>) -> Option<Arc<CertifiedKey>> {
+    Some(self.current())
+  }
+}
+
+fn modified_at(path: impl AsRef<Path>) -> Option<SystemTime> {
+  fs::metadata(path).ok()?.modified().ok()
+}
+
+fn load_certified_key(cert_path: &str, key_path: &str) -> io::Result<CertifiedKey> {
+  let certs = crate::load_certs(cert_path)?;
+  let key = crate::load_private_key(key_path)?;
+  let signing_key = rustls::crypto::ring::sign::any_supported_type(&key)
+    .map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e.to_string()))?;
+  Ok(CertifiedKey::new(certs, signing_key))
+}
+
+#[cfg(test)]
+mod tests {
+  use super::*;
+
+  const CERT: &str = "../fixture/certs/server-cert.pem";
+  const KEY: &str = "../fixture/certs/server-key.pem";
+
+  #[test]
+  fn loads_the_fixture_certificate() {
+    let resolver = ReloadingCertResolver::load(CERT, KEY).unwrap();
+    assert!(!resolver.current().cert.is_empty());
+  }
+
+  #[test]
+  fn reload_swaps_in_a_fresh_certificate_for_new_handshakes() {
+    let resolver = ReloadingCertResolver::load(CERT, KEY).unwrap();
+    let before = Arc::as_ptr(&resolver.current());
+    resolver.reload().unwrap();
+    // New handshakes resolve the freshly loaded key while existing connections are
+    // untouched by the swap.
+    assert_ne!(before, Arc::as_ptr(&resolver.current()));
+  }
+
+  #[test]
+  fn missing_files_fail_to_load() {
+    assert!(ReloadingCertResolver::load("/nonexistent.pem", KEY).is_err());
+  }
+}
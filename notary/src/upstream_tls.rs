@@ -0,0 +1,192 @@
+use std::{io, sync::Arc};
+
+use rustls::{
+  client::danger::{HandshakeSignatureValid, ServerCertVerified, ServerCertVerifier},
+  crypto::ring,
+  pki_types::{CertificateDer, ServerName, UnixTime},
+  ClientConfig, DigitallySignedStruct, RootCertStore, SignatureScheme,
+};
+use tokio::net::TcpStream;
+use tokio_rustls::TlsConnector;
+
+/// Builds the client-side TLS configuration for upstream connections.
+///
+/// Certificate chains are validated against the PEM bundle at `roots_path` when set (e.g.
+/// a private CA), and against the bundled webpki roots otherwise. `insecure` skips chain
+/// validation entirely — a testing escape hatch, never to be enabled where the transcript
+/// is meant to prove anything. `min_version` is `"1.2"` (also the default for the empty
+/// string) or `"1.3"`; anything else is refused rather than silently weakened.
+pub fn client_config(
+  roots_path: &str,
+  insecure: bool,
+  min_version: &str,
+) -> io::Result<Arc<ClientConfig>> {
+  let versions: &[&rustls::SupportedProtocolVersion] = match min_version {
+    "" | "1.2" => rustls::DEFAULT_VERSIONS,
+    "1.3" => &[&rustls::version::TLS13],
+    other => {
+      let message = format!("unsupported upstream_tls_min_version {:?}", other);
+      return Err(io::Error::new(io::ErrorKind::InvalidInput, message));
+    },
+  };
+  let builder = ClientConfig::builder_with_provider(Arc::new(ring::default_provider()))
+    .with_protocol_versions(versions)
+    .map_err(|e| io::Error::new(io::ErrorKind::InvalidInput, e.to_string()))?;
+  let config = if insecure {
+    builder
+      .dangerous()
+      .with_custom_certificate_verifier(Arc::new(InsecureVerifier(ring::default_provider())))
+      .with_no_client_auth()
+  } else {
+    let mut roots = RootCertStore::empty();
+    if roots_path.is_empty() {
+      roots.extend(webpki_roots::TLS_SERVER_ROOTS.iter().cloned());
+    } else {
+      for cert in crate::load_certs(roots_path)? {
+        roots.add(cert).map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e.to_string()))?;
+      }
+    }
+    builder.with_root_certificates(roots).with_no_client_auth()
+  };
+  Ok(Arc::new(config))
+}
+
+/// Completes the TLS handshake over the already-dialed target connection. `host` is the
+/// hostname the client asked for — not the resolved IP the socket was dialed to — so SNI
+/// and certificate validation check the name the transcript will claim.
+pub async fn wrap(
+  tcp: TcpStream,
+  host: &str,
+  config: Arc<ClientConfig>,
+) -> io::Result<tokio_rustls::client::TlsStream<TcpStream>> {
+  let server_name = ServerName::try_from(host.to_string()).map_err(|_| {
+    io::Error::new(io::ErrorKind::InvalidInput, format!("invalid SNI host {:?}", host))
+  })?;
+  TlsConnector::from(config).connect(server_name, tcp).await
+}
+
+/// Verifier behind `upstream_insecure` that accepts any certificate chain. Handshake
+/// signatures are still checked, so the connection is at least self-consistent.
+#[derive(Debug)]
+struct InsecureVerifier(rustls::crypto::CryptoProvider);
+
+impl ServerCertVerifier for InsecureVerifier {
+  fn verify_server_cert(
+    &self,
+    _end_entity: &CertificateDer<'_>,
+    _intermediates: &[CertificateDer<'_>],
+    _server_name: &ServerName<'_>,
+    _ocsp_response: &[u8],
+    _now: UnixTime,
+  ) -> Result<ServerCertVerified, rustls::Error> {
+    Ok(ServerCertVerified::assertion())
+  }
+
+  fn verify_tls12_signature(
+    &self,
+    message: &[u8],
+    cert: &CertificateDer<'_>,
+    dss: &DigitallySignedStruct,
+  ) -> Result<HandshakeSignatureValid, rustls::Error> {
+    rustls::crypto::verify_tls12_signature(
+      message,
+      cert,
+      dss,
+      &self.0.signature_verification_algorithms,
+    )
+  }
+
+  fn verify_tls13_signature(
+    &self,
+    message: &[u8],
+    cert: &CertificateDer<'_>,
+    dss: &DigitallySignedStruct,
+  ) -> Result<HandshakeSignatureValid, rustls::Error> {
+    rustls::crypto::verify_tls13_signature(
+      message,
+      cert,
+      dss,
+      &self.0.signature_verification_algorithms,
+    )
+  }
+
+  fn supported_verify_schemes(&self) -> Vec<SignatureScheme> {
+    self.0.signature_verification_algorithms.supported_schemes()
+  }
+}
+
+#[cfg(test)]
+mod tests {
+  use std::sync::Arc;
+
+  use tokio::io::{AsyncReadExt, AsyncWriteExt};
+  use tokio_rustls::TlsAcceptor;
+
+  use super::{client_config, wrap};
+
+  const CA: &str = "../fixture/certs/ca-cert.pem";
+  const CERT: &str = "../fixture/certs/server-cert.pem";
+  const KEY: &str = "../fixture/certs/server-key.pem";
+
+  /// Starts a one-shot TLS server on the fixture certificate that echoes one line.
+  async fn start_tls_echo() -> std::net::SocketAddr {
+    let certs = crate::load_certs(CERT).unwrap();
+    let key = crate::load_private_key(KEY).unwrap();
+    let server_config =
+      rustls::ServerConfig::builder().with_no_client_auth().with_single_cert(certs, key).unwrap();
+    let acceptor = TlsAcceptor::from(Arc::new(server_config));
+    let listener = tokio::net::TcpListener::bind("127.0.0.1:0").await.unwrap();
+    let addr = listener.local_addr().unwrap();
+    tokio::spawn(async move {
+      let (conn, _) = listener.accept().await.unwrap();
+      let Ok(mut tls) = acceptor.accept(conn).await else { return };
+      let mut buf = [0u8; 64];
+      let n = tls.read(&mut buf).await.unwrap();
+      tls.write_all(&buf[..n]).await.unwrap();
+      tls.shutdown().await.unwrap();
+    });
+    addr
+  }
+
+  #[tokio::test]
+  async fn handshake_succeeds_against_the_fixture_ca_with_matching_sni() {
+    let addr = start_tls_echo().await;
+    let config = client_config(CA, false, "").unwrap();
+    let tcp = tokio::net::TcpStream::connect(addr).await.unwrap();
+
+    let mut tls = wrap(tcp, "localhost", config).await.unwrap();
+    tls.write_all(b"ping").await.unwrap();
+    let mut echoed = [0u8; 4];
+    tls.read_exact(&mut echoed).await.unwrap();
+    assert_eq!(&echoed, b"ping");
+  }
+
+  #[tokio::test]
+  async fn untrusted_chain_is_rejected_unless_insecure_is_set() {
+    // Without the fixture CA in the roots the chain does not validate...
+    let addr = start_tls_echo().await;
+    let config = client_config("", false, "").unwrap();
+    let tcp = tokio::net::TcpStream::connect(addr).await.unwrap();
+    assert!(wrap(tcp, "localhost", config).await.is_err());
+
+    // ...and the insecure escape hatch accepts exactly the same chain.
+    let addr = start_tls_echo().await;
+    let config = client_config("", true, "").unwrap();
+    let tcp = tokio::net::TcpStream::connect(addr).await.unwrap();
+    assert!(wrap(tcp, "localhost", config).await.is_ok());
+  }
+
+  #[tokio::test]
+  async fn sni_mismatch_fails_validation() {
+    let addr = start_tls_echo().await;
+    let config = client_config(CA, false, "").unwrap();
+    let tcp = tokio::net::TcpStream::connect(addr).await.unwrap();
+    assert!(wrap(tcp, "elsewhere.example.com", config).await.is_err());
+  }
+
+  #[test]
+  fn unknown_min_version_is_refused() {
+    assert!(client_config("", false, "1.1").is_err());
+    assert!(client_config("", false, "ssl3").is_err());
+  }
+}